@@ -1,51 +1,76 @@
 package main
 
 import (
-	"net/url"
-	"strings"
-
-	"github.com/PuerkitoBio/goquery"
+	"context"
+	"errors"
+	"time"
 )
 
-// CollectEdiktAlldocURLs iterates over Edikt search result pages, downloads each page,
-// extracts all "alldoc..." links via ExtractEdiktAlldocURLs, and returns a flat slice of absolute URLs.
-func CollectEdiktAlldocURLs(ediktPageLinks []string) []string {
-	// Preallocate with zero length. Capacity is unknown; keep default to avoid guesswork.
-	edikte := make([]string, 0, 50)
-
-	// Iterate over each search result page URL.
-	for _, link := range ediktPageLinks {
-		// Fetch and parse the page. The second return value is intentionally ignored per the caller's API.
-		doc, _, baseURL := RequestPage(link)
-		// Extract all absolute "alldoc" URLs from the page.
-		ediktAlldocURLs := extractEdiktAlldocURLs(doc, baseURL)
-		// Append the page's results to the aggregated slice.
-		edikte = append(edikte, ediktAlldocURLs...)
-	}
+// maxSplitDepth bounds how often a truncated query is split into sub-queries.
+const maxSplitDepth = 8
+
+// CollectListings runs each search query, downloads its result page and parses it via ParseListing.
+// Up to workers queries are run concurrently; the output keeps the order of queries.
+//
+// The portal silently cuts result sets at SearchMax. A truncated result is split into
+// sub-queries (see SearchQuery.split) until each one is complete, so one query can yield
+// several listings. If a query cannot be split further, its listing is marked Truncated
+// and a warning is printed.
+//
+// A failed result page does not stop the collection; its error is joined into err.
+func CollectListings(ctx context.Context, queries []SearchQuery, workers int) (listings []*Listing, err error) {
+	// One result slot per query, so concurrent fetches do not reorder the output.
+	results := make([][]*Listing, len(queries))
+	errs := make([]error, len(queries))
 
-	// Return the aggregated list of absolute "alldoc" URLs.
-	return edikte
+	// Run each search query.
+	parallel(ctx, len(queries), workers, func(ctx context.Context, i int) {
+		results[i], errs[i] = collectComplete(ctx, queries[i], 0)
+	})
+
+	for _, r := range results {
+		listings = append(listings, r...)
+	}
+	return listings, errors.Join(errs...)
 }
 
-// ExtractEdiktAlldocURLsextractEdiktAlldocURLs extracts absolute URLs from <a> elements on the Austrian "Edikte"
-// search page whose href starts with the literal prefix "alldoc". It resolves relative hrefs against 'base'.
-// Site context: https://edikte.justiz.gv.at/edikte/
-//
-// Output a slice of absolute URL strings, in encounter order. Duplicates are preserved.
-func extractEdiktAlldocURLs(doc *goquery.Document, base *url.URL) []string {
-	// Preallocate to reduce reallocations for typical page sizes
-	ret := make([]string, 0, 50)
-
-	// Iterate all anchors that have an href attribute
-	doc.Find("a[href]").Each(func(i int, s *goquery.Selection) {
-		// Only consider links starting with "alldoc"
-		if href, ok := s.Attr("href"); ok && strings.HasPrefix(href, "alldoc") {
-			// Parse and resolve to absolute URL; ignore parse errors per original behavior
-			rel, _ := url.Parse(href)
-			abs := base.ResolveReference(rel).String()
-			ret = append(ret, abs)
+// collectComplete fetches one query and recursively splits it while the result is truncated.
+func collectComplete(ctx context.Context, query SearchQuery, depth int) ([]*Listing, error) {
+	// Fetch and parse the page. The second return value is intentionally ignored per the caller's API.
+	doc, _, baseURL, err := RequestPage(ctx, query.URL())
+	if err != nil {
+		return nil, err
+	}
+	// Extract all result rows from the page.
+	listing := ParseListing(doc, baseURL)
+	if !listing.truncated(query.limit()) {
+		return []*Listing{listing}, nil
+	}
+
+	// Give up splitting if the query is as narrow as it gets.
+	now := time.Now().In(viennaLocation())
+	subs := query.split(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()))
+	if len(subs) == 0 || depth >= maxSplitDepth {
+		listing.Truncated = true
+		logWarn("Warning: search result truncated, cannot guarantee completeness:", listing.URL)
+		return []*Listing{listing}, nil
+	}
+
+	// Run the sub-queries one after another; the caller already parallelizes across queries.
+	var listings []*Listing
+	var errs []error
+	for _, sub := range subs {
+		ls, err := collectComplete(ctx, sub, depth+1)
+		listings = append(listings, ls...)
+		if err != nil {
+			errs = append(errs, err)
 		}
-	})
+	}
 
-	return ret
+	// Keep the truncated rows if a sub-query failed; duplicates are merged by the caller.
+	if len(errs) > 0 {
+		listing.Truncated = true
+		listings = append(listings, listing)
+	}
+	return listings, errors.Join(errs...)
 }
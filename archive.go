@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// manifestName is the file in every edikt directory that lists its archived documents.
+const manifestName = "documents.json"
+
+// Document is one archived file of an edikt, as recorded in the manifest of its directory.
+type Document struct {
+	URL          string    `json:"url"`                     // absolute URL of the document
+	File         string    `json:"file"`                    // file name inside the edikt directory
+	ContentType  string    `json:"content_type,omitempty"`  // Content-Type header
+	Size         int64     `json:"size"`                    // file size in bytes
+	SHA256       string    `json:"sha256"`                  // hex digest of the file content
+	ETag         string    `json:"etag,omitempty"`          // validator for conditional downloads
+	LastModified string    `json:"last_modified,omitempty"` // validator for conditional downloads
+	FetchedAt    time.Time `json:"fetched_at"`              // last download or successful revalidation
+	TextFile     string    `json:"text_file,omitempty"`     // extracted plain text next to the file, see ExtractPDFText
+}
+
+// archive keeps a local copy of the Langgutachten of alerted edikte, because the portal
+// removes them after the auction.
+//
+// Every edikt gets its own directory "<dir>/<EdiktRecord.ID>" with the documents and a
+// manifest (manifestName). Documents are streamed to disk, never buffered in memory, and
+// rejected once they exceed maxBytes. A document is downloaded again only if the server
+// does not confirm the archived copy; if the new download has the same SHA-256, the
+// archived file is kept untouched. The text of every PDF is extracted into a ".txt" file
+// next to it, so the appraisals can be searched without opening each PDF.
+type archive struct {
+	dir      string
+	maxBytes int64
+}
+
+// newArchive returns an archive for the given config, or nil if archiving is disabled.
+func newArchive(cfg ArchiveConfig) *archive {
+	if cfg.Dir == "" {
+		return nil
+	}
+	return &archive{
+		dir:      cfg.Dir,
+		maxBytes: int64(cfg.MaxSizeMB) << 20,
+	}
+}
+
+// Dir returns the archive directory of rec.
+func (a *archive) Dir(rec *EdiktRecord) string {
+	return filepath.Join(a.dir, rec.ID())
+}
+
+// Save archives all Langgutachten of rec and returns the updated manifest.
+// Documents that are no longer linked stay in the archive and the manifest.
+// A failed document does not stop the others; all errors are returned joined.
+func (a *archive) Save(ctx context.Context, rec *EdiktRecord) ([]Document, error) {
+	dir := a.Dir(rec)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	docs, err := readManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for i, link := range rec.LanggutachtenLinks {
+		// Look up the previous download of this URL.
+		prev := -1
+		for j := range docs {
+			if docs[j].URL == link {
+				prev = j
+				break
+			}
+		}
+
+		var doc Document
+		if prev >= 0 {
+			doc, err = a.download(ctx, dir, link, docs[prev].File, &docs[prev])
+		} else {
+			doc, err = a.download(ctx, dir, link, fileName(docs, i, link), nil)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		// Extract the text of new and changed PDFs, and of PDFs that have no text file yet.
+		changed := prev < 0 || docs[prev].SHA256 != doc.SHA256
+		if !changed {
+			doc.TextFile = docs[prev].TextFile
+		}
+		if changed || doc.TextFile == "" || !fileExists(filepath.Join(dir, doc.TextFile)) {
+			if err := extractText(dir, &doc); err != nil {
+				errs = append(errs, err)
+			}
+		}
+
+		if prev >= 0 {
+			docs[prev] = doc
+		} else {
+			docs = append(docs, doc)
+		}
+	}
+
+	// Record the successful downloads even if some failed.
+	data, err := json.MarshalIndent(docs, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, manifestName), data); err != nil {
+		return nil, err
+	}
+	return docs, errors.Join(errs...)
+}
+
+// download streams link into dir/name. prev is the manifest entry of an earlier download, or nil.
+func (a *archive) download(ctx context.Context, dir, link, name string, prev *Document) (Document, error) {
+	target := filepath.Join(dir, name)
+
+	// Documents may be large: allow more time than for pages, the size cap bounds the transfer.
+	client := &http.Client{
+		Timeout: 5 * time.Minute,
+	}
+
+	// Build a GET request bound to the context.
+	req, err := newRequest(ctx, link)
+	if err != nil {
+		return Document{}, err
+	}
+
+	// Only ask for confirmation if the archived copy still exists.
+	if prev != nil && fileExists(target) {
+		setConditional(req, prev.ETag, prev.LastModified)
+	}
+
+	// Execute the HTTP call, retrying transient failures.
+	resp, err := send(ctx, client, req)
+	if err != nil {
+		return Document{}, err
+	}
+	defer resp.Body.Close()
+
+	// The archived copy is still valid.
+	if resp.StatusCode == http.StatusNotModified && prev != nil {
+		doc := *prev
+		doc.FetchedAt = time.Now()
+		logDebug("Unchanged", target)
+		return doc, nil
+	}
+
+	// Enforce a successful 2xx status.
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return Document{}, &HTTPStatusError{URL: link, StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+
+	// Reject announced oversize documents before reading anything.
+	if a.maxBytes > 0 && resp.ContentLength > a.maxBytes {
+		return Document{}, &DocumentTooLargeError{URL: link, Limit: a.maxBytes}
+	}
+
+	// Stream into a temporary file next to the target, hashing on the way.
+	// Reading one byte more than allowed detects oversize documents without Content-Length.
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return Document{}, err
+	}
+	defer os.Remove(tmp.Name()) // no-op after the rename
+
+	body := io.Reader(resp.Body)
+	if a.maxBytes > 0 {
+		body = io.LimitReader(resp.Body, a.maxBytes+1)
+	}
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return Document{}, fmt.Errorf("GET %s: %w", link, err)
+	}
+	if a.maxBytes > 0 && size > a.maxBytes {
+		return Document{}, &DocumentTooLargeError{URL: link, Limit: a.maxBytes}
+	}
+
+	doc := Document{
+		URL:          link,
+		File:         name,
+		ContentType:  resp.Header.Get("Content-Type"),
+		Size:         size,
+		SHA256:       hex.EncodeToString(hash.Sum(nil)),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+	}
+
+	// Same content as before: keep the archived file and its timestamps.
+	if prev != nil && prev.SHA256 == doc.SHA256 && fileExists(target) {
+		logDebug("Unchanged", target)
+		return doc, nil
+	}
+
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return Document{}, err
+	}
+	logInfo("Archived", target, size, "bytes")
+	return doc, nil
+}
+
+// extractText writes the text of the PDF doc into a text file next to it and records it in doc.
+// Other file types are skipped. An empty text file is kept for scanned PDFs, so they are not retried on every run.
+func extractText(dir string, doc *Document) error {
+	path := filepath.Join(dir, doc.File)
+	if !isPDF(path) {
+		doc.TextFile = ""
+		return nil
+	}
+
+	text, err := ExtractPDFText(path)
+	if err != nil {
+		return err
+	}
+	name := textFileName(doc.File)
+	if err := writeFileAtomic(filepath.Join(dir, name), []byte(text)); err != nil {
+		return err
+	}
+	doc.TextFile = name
+	logInfo("Extracted", filepath.Join(dir, name), len(text), "bytes")
+	return nil
+}
+
+// readManifest returns the manifest of an edikt directory, or nil if there is none yet.
+func readManifest(dir string) ([]Document, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var docs []Document
+	if err := json.Unmarshal(data, &docs); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", filepath.Join(dir, manifestName), err)
+	}
+	return docs, nil
+}
+
+// fileName derives a file name for the i-th document link from the last segment of its URL,
+// e.g. "Gutachten.pdf" from ".../$FILE/Gutachten.pdf". Characters that are unsafe in file names
+// are replaced. Names already used by other documents get the index as prefix.
+func fileName(docs []Document, i int, link string) string {
+	name := ""
+	if u, err := url.Parse(link); err == nil && strings.Trim(u.Path, "/") != "" {
+		name = path.Base(u.Path)
+	}
+	name = strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" || strings.HasPrefix(name, ".") || name == manifestName {
+		name = fmt.Sprintf("langgutachten-%d", i+1)
+	}
+
+	for _, d := range docs {
+		if strings.EqualFold(d.File, name) || strings.EqualFold(d.TextFile, name) {
+			return fmt.Sprintf("%d-%s", i+1, name)
+		}
+	}
+	return name
+}
+
+// fileExists reports whether path names an existing file.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// urlClass groups URLs with the same caching needs.
+type urlClass int
+
+const (
+	classListing  urlClass = iota // search result pages ("suchedi"), change often
+	classDetail                   // edikt detail pages ("alldoc"), change rarely
+	classDocument                 // attachments like Kurz- and Langgutachten PDFs, practically never change
+)
+
+// classify returns the urlClass of link.
+func classify(link string) urlClass {
+	lower := strings.ToLower(link)
+	switch {
+	case strings.Contains(lower, "/suchedi?"):
+		return classListing
+	case strings.Contains(lower, "/alldoc/") && !strings.Contains(lower, "/$file/"):
+		return classDetail
+	default:
+		return classDocument
+	}
+}
+
+// httpCache is a persistent, size-bounded on-disk cache for Request.
+//
+// Each URL is stored as two files named after the SHA-256 of the URL:
+// "<hash>.body" holds the response body and "<hash>.json" the cacheEntry.
+// Entries younger than their class TTL are served without a request; older entries are
+// revalidated with If-None-Match / If-Modified-Since. When the bodies exceed maxBytes,
+// the least recently used entries are evicted (the body's mtime is the access time).
+// Sizes and access times are indexed in memory, so the directory is scanned only once per run.
+type httpCache struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+	ttl      map[urlClass]time.Duration
+
+	files map[string]cachedFile // body path -> size and last access, see load
+	total int64                 // sum of the body sizes in files
+}
+
+// cachedFile is the index entry of one cached body.
+type cachedFile struct {
+	size  int64
+	atime time.Time
+}
+
+// cacheEntry is the metadata of one cached response.
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	FinalURL     string    `json:"final_url,omitempty"`    // URL after redirects
+	ContentType  string    `json:"content_type,omitempty"` // Content-Type header
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	StoredAt     time.Time `json:"stored_at"` // time of the last download or successful revalidation
+	Size         int64     `json:"size"`
+}
+
+// response converts the entry and its cached body into a response.
+func (e *cacheEntry) response(body []byte) *response {
+	finalURL := e.FinalURL
+	if finalURL == "" {
+		finalURL = e.URL
+	}
+	return &response{Body: body, URL: finalURL, ContentType: e.ContentType}
+}
+
+// requestCache is used by Request; nil disables caching. It is set from the config by main.
+var requestCache *httpCache
+
+// newHTTPCache returns a cache for the given config, or nil if caching is disabled.
+func newHTTPCache(cfg CacheConfig) *httpCache {
+	if cfg.Dir == "" {
+		return nil
+	}
+	return &httpCache{
+		dir:      cfg.Dir,
+		maxBytes: int64(cfg.MaxSizeMB) << 20,
+		ttl: map[urlClass]time.Duration{
+			classListing:  time.Duration(cfg.ListingTTL),
+			classDetail:   time.Duration(cfg.DetailTTL),
+			classDocument: time.Duration(cfg.DocumentTTL),
+		},
+	}
+}
+
+// paths returns the body and metadata file paths for link.
+func (c *httpCache) paths(link string) (body, meta string) {
+	sum := sha256.Sum256([]byte(link))
+	name := filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+	return name + ".body", name + ".json"
+}
+
+// Lookup returns the cached response for link, if any.
+// fresh reports whether the entry is younger than the TTL of its class and can be used without revalidation.
+// Read errors are treated as a cache miss.
+func (c *httpCache) Lookup(link string) (body []byte, entry *cacheEntry, fresh bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	bodyPath, metaPath := c.paths(link)
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		return nil, nil, false
+	}
+	entry = new(cacheEntry)
+	if err := json.Unmarshal(data, entry); err != nil || entry.URL != link {
+		return nil, nil, false
+	}
+	body, err = os.ReadFile(bodyPath)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	// Record the access for LRU eviction, on disk for the next run and in the index.
+	now := time.Now()
+	_ = os.Chtimes(bodyPath, now, now)
+	if f, ok := c.files[bodyPath]; ok {
+		f.atime = now
+		c.files[bodyPath] = f
+	}
+
+	return body, entry, now.Sub(entry.StoredAt) < c.ttl[classify(link)]
+}
+
+// Revalidate marks the entry of link as fresh again after a 304 Not Modified.
+func (c *httpCache) Revalidate(link string, entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry.StoredAt = time.Now()
+	_, metaPath := c.paths(link)
+	if data, err := json.Marshal(entry); err == nil {
+		_ = writeFileAtomic(metaPath, data)
+	}
+}
+
+// Store saves a 2xx response and evicts old entries if the cache grew too large.
+// Errors are ignored: a broken cache must never break a run.
+func (c *httpCache) Store(link, finalURL string, header http.Header, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return
+	}
+	c.load()
+	entry := cacheEntry{
+		URL:          link,
+		FinalURL:     finalURL,
+		ContentType:  header.Get("Content-Type"),
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		StoredAt:     time.Now(),
+		Size:         int64(len(body)),
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	// Write the body first, so a metadata file never points to a missing body.
+	bodyPath, metaPath := c.paths(link)
+	if writeFileAtomic(bodyPath, body) != nil || writeFileAtomic(metaPath, data) != nil {
+		return
+	}
+	c.total += entry.Size - c.files[bodyPath].size
+	c.files[bodyPath] = cachedFile{size: entry.Size, atime: entry.StoredAt}
+	c.evict()
+}
+
+// load builds the index from the bodies in the cache directory, once.
+func (c *httpCache) load() {
+	if c.files != nil {
+		return
+	}
+	c.files = make(map[string]cachedFile)
+	matches, _ := filepath.Glob(filepath.Join(c.dir, "*.body"))
+	for _, m := range matches {
+		info, err := os.Stat(m)
+		if err != nil {
+			continue
+		}
+		c.files[m] = cachedFile{size: info.Size(), atime: info.ModTime()}
+		c.total += info.Size()
+	}
+}
+
+// evict removes the least recently used entries once the bodies exceed maxBytes,
+// down to 90% of it, so the index is not sorted again with every new entry.
+// maxBytes <= 0 means unbounded.
+func (c *httpCache) evict() {
+	if c.maxBytes <= 0 || c.total <= c.maxBytes {
+		return
+	}
+
+	// Oldest access first.
+	paths := slices.SortedFunc(maps.Keys(c.files), func(a, b string) int {
+		return c.files[a].atime.Compare(c.files[b].atime)
+	})
+	for _, path := range paths {
+		if c.total <= c.maxBytes/10*9 {
+			break
+		}
+		_ = os.Remove(strings.TrimSuffix(path, ".body") + ".json")
+		_ = os.Remove(path)
+		c.total -= c.files[path].size
+		delete(c.files, path)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file and renames it to path,
+// so readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
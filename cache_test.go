@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+)
+
+func TestHTTPCacheEvict(t *testing.T) {
+	dir := t.TempDir()
+	body := bytes.Repeat([]byte("x"), 40)
+
+	// A second cache on the same directory must pick up the bodies of the first.
+	c := &httpCache{dir: dir, maxBytes: 100}
+	c.Store("https://example.com/a", "", http.Header{}, body)
+	c.Store("https://example.com/b", "", http.Header{}, body)
+	c = &httpCache{dir: dir, maxBytes: 100}
+
+	// "a" was used more recently than "b", so "b" goes first.
+	if got, _, _ := c.Lookup("https://example.com/a"); got == nil {
+		t.Fatal("a not cached")
+	}
+	c.Store("https://example.com/c", "", http.Header{}, body)
+
+	for link, want := range map[string]bool{
+		"https://example.com/a": true,
+		"https://example.com/b": false,
+		"https://example.com/c": true,
+	} {
+		if got, _, _ := c.Lookup(link); (got != nil) != want {
+			t.Errorf("%s cached = %v, want %v", link, got != nil, want)
+		}
+	}
+	if c.total != 80 {
+		t.Errorf("total = %d, want 80", c.total)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"maps"
+	"net/http"
+	"slices"
+)
+
+// FieldChange is one field of an edikt page whose value changed between two fetches.
+// An empty Old means the field was added, an empty New that it was removed.
+type FieldChange struct {
+	Field string // page label, e.g. "Versteigerungstermin"
+	Old   string
+	New   string
+}
+
+// DiffRecords compares the status and the page fields (EdiktRecord.Felder) of two snapshots
+// of the same edikt and returns the changes, the status first and the fields sorted by label.
+// The typed fields are derived from the page fields and therefore not compared separately;
+// fields merged from the Kurzgutachten are ignored, because they are not fetched for every snapshot.
+func DiffRecords(old, rec *EdiktRecord) []FieldChange {
+	var changes []FieldChange
+	if old.Status != rec.Status && old.Status != "" {
+		changes = append(changes, FieldChange{Field: labelStatus, Old: old.Status.String(), New: rec.Status.String()})
+	}
+	labels := slices.Sorted(maps.Keys(old.Felder))
+	for _, label := range slices.Sorted(maps.Keys(rec.Felder)) {
+		if _, ok := old.Felder[label]; !ok {
+			labels = append(labels, label)
+		}
+	}
+	slices.Sort(labels)
+
+	for _, label := range labels {
+		if o, n := old.Felder[label], rec.Felder[label]; o != n {
+			changes = append(changes, FieldChange{Field: label, Old: o, New: n})
+		}
+	}
+	return changes
+}
+
+// ediktChanges are the changes of one tracked edikt in this run.
+type ediktChanges struct {
+	URL     string
+	Rec     *EdiktRecord // new snapshot; nil if the edikt is gone
+	Changes []FieldChange
+}
+
+// Pseudo fields reported besides the page labels.
+const (
+	labelStatus = "Status" // Status of the auction
+	labelGone   = "Edikt"  // the edikt was removed from the portal
+)
+
+// collectChanges compares every tracked item with its last stored snapshot.
+// Items whose detail page answers 404 or 410 are reported as removed, with a nil Rec;
+// the caller ends their tracking with DB.MarkGone.
+// Tracked items without a stored snapshot (e.g. migrated from db.dat) have nothing to compare.
+// Must run before the new snapshots are stored by DB.Observe.
+func collectChanges(items []*item, db *DB) ([]ediktChanges, error) {
+	var all []ediktChanges
+	for _, it := range items {
+		if !it.Tracked {
+			continue
+		}
+
+		// A page that is gone ends the tracking; other errors are retried next run.
+		var statusErr *HTTPStatusError
+		if errors.As(it.Err, &statusErr) &&
+			(statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusGone) {
+			logInfo("Gone", it.URL)
+			all = append(all, ediktChanges{URL: it.URL, Changes: []FieldChange{
+				{Field: labelGone, Old: "veröffentlicht", New: "nicht mehr abrufbar"},
+			}})
+			continue
+		}
+		if it.Err != nil {
+			continue
+		}
+
+		old, err := db.LastRecord(it.URL)
+		if err != nil {
+			return nil, err
+		}
+		if old == nil {
+			continue
+		}
+		if changes := DiffRecords(old, it.Rec); len(changes) > 0 {
+			logInfo("Changed", len(changes), "fields", it.URL)
+			all = append(all, ediktChanges{URL: it.URL, Rec: it.Rec, Changes: changes})
+		}
+	}
+	return all, nil
+}
+
+// orDash returns s, or "–" for an empty value.
+func orDash(s string) string {
+	if s == "" {
+		return "–"
+	}
+	return s
+}
@@ -0,0 +1,532 @@
+package main
+
+import (
+	"context"
+	"ediktscraper/email"
+	"ediktscraper/expr"
+	"ediktscraper/openstreetmap"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// command is a subcommand of the CLI.
+type command struct {
+	name string // one or two words, e.g. "db migrate"
+	args string // synopsis of the arguments for the usage
+	help string
+	run  func(ctx context.Context, a *app, args []string) error
+}
+
+// commands are the subcommands in the order of the usage. Without a command, "run" runs.
+var commands = []command{
+	{"run", "", "scrape, filter and mail new matches and changes", cmdRun},
+	{"dry-run", "", "like run, but print the mails and write neither DB nor archive", cmdDryRun},
+	{"explain", "<url>", "fetch one edikt and show every field and every profile check", cmdExplain},
+	{"list", "[filters]", "list stored edikte by state, status, value, place or rule (list -h)", cmdList},
+	{"show", "<id|url>", "show a stored edikt with its record and recipients", cmdShow},
+	{"export", "[-format json|csv]", "write all stored edikte to stdout", cmdExport},
+	{"forget", "<id|url>", "delete a stored edikt, so it is mailed again if it matches", cmdForget},
+	{"db migrate", "[file]", "import the gob database of earlier versions (default " + legacyDBPath + ")", cmdDBMigrate},
+	{"config check", "", "validate the config and mail config", cmdConfigCheck},
+	{"template check", "[-html file]", "render the mail templates with sample data", cmdTemplateCheck},
+}
+
+// app holds the global flags and lazily loads the config and opens the DB for the commands.
+type app struct {
+	configPath string
+	dbPath     string
+	mailPath   string
+
+	cfg *Config
+	db  *DB
+}
+
+// config returns the config, loading it on first use.
+func (a *app) config() (*Config, error) {
+	if a.cfg == nil {
+		cfg, err := LoadOrInitConfig(a.configPath)
+		if err != nil {
+			return nil, err
+		}
+		a.cfg = cfg
+	}
+	return a.cfg, nil
+}
+
+// database returns the DB, opening it on first use.
+func (a *app) database() (*DB, error) {
+	if a.db == nil {
+		db, err := OpenDB(a.dbPath)
+		if err != nil {
+			return nil, err
+		}
+		a.db = db
+	}
+	return a.db, nil
+}
+
+// close closes the DB if it was opened.
+func (a *app) close() error {
+	if a.db == nil {
+		return nil
+	}
+	return a.db.Close()
+}
+
+func main() {
+	a := &app{}
+	flag.StringVar(&a.configPath, "config", defaultConfigPath, "search profiles and settings")
+	flag.StringVar(&a.dbPath, "db", defaultDBPath, "SQLite database of seen and notified edikte")
+	flag.StringVar(&a.mailPath, "mail", "mail.conf", "SMTP settings and default recipients")
+	level := flag.String("log-level", "info", "status output: debug, info, warn or error")
+	flag.Usage = printUsage
+	flag.Parse()
+
+	var err error
+	if logLevel, err = ParseLogLevel(*level); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	email.SetConfigPath(a.mailPath)
+
+	cmd, args, ok := findCommand(flag.Args())
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", strings.Join(flag.Args(), " "))
+		printUsage()
+		os.Exit(2)
+	}
+
+	// Ctrl-C or SIGTERM cancel the context; all stages stop and nothing is sent or stored.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err = cmd.run(ctx, a, args)
+	stop()
+	if cerr := a.close(); err == nil {
+		err = cerr
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// findCommand returns the command named by the leading words of args and the remaining arguments.
+func findCommand(args []string) (command, []string, bool) {
+	if len(args) == 0 {
+		return commands[0], nil, true
+	}
+	for _, c := range commands {
+		words := strings.Fields(c.name)
+		if len(args) >= len(words) && slices.Equal(args[:len(words)], words) {
+			return c, args[len(words):], true
+		}
+	}
+	return command{}, nil, false
+}
+
+// printUsage prints the commands and global flags to stderr.
+func printUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "Usage: ediktscraper [flags] [command] [arguments]")
+	fmt.Fprintln(out, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-36s %s\n", strings.TrimSpace(c.name+" "+c.args), c.help)
+	}
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+// usageError reports wrong arguments of c.
+func usageError(name, args string) error {
+	return fmt.Errorf("usage: ediktscraper %s %s", name, args)
+}
+
+// ------------------------------------------------------------------------------------------------------------------ //
+
+func cmdRun(ctx context.Context, a *app, args []string) error {
+	return runPipeline(ctx, a, args, false)
+}
+
+func cmdDryRun(ctx context.Context, a *app, args []string) error {
+	return runPipeline(ctx, a, args, true)
+}
+
+// runPipeline implements "run" and "dry-run". A real run first imports legacyDBPath if it exists.
+func runPipeline(ctx context.Context, a *app, args []string, dry bool) error {
+	if len(args) > 0 {
+		return fmt.Errorf("unexpected arguments %q", args)
+	}
+	cfg, err := a.config()
+	if err != nil {
+		return err
+	}
+	db, err := a.database()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(legacyDBPath); err == nil && !dry {
+		n, err := db.MigrateLegacy(legacyDBPath)
+		if err != nil {
+			return err
+		}
+		logInfo("Migrated", n, "edikte from", legacyDBPath)
+	}
+	configure(cfg, db)
+	return run(ctx, cfg, db, dry)
+}
+
+func cmdExplain(ctx context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return usageError("explain", "<url>")
+	}
+	cfg, err := a.config()
+	if err != nil {
+		return err
+	}
+	db, err := a.database()
+	if err != nil {
+		return err
+	}
+	configure(cfg, db)
+	openstreetmap.SetStore(readOnlyGeocodes{db})
+	return explain(ctx, os.Stdout, cfg, db, args[0])
+}
+
+func cmdList(_ context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	var f listFilter
+	notified := fs.Bool("notified", false, "only edikte that were mailed")
+	fs.StringVar(&f.state, "state", "", "only edikte in this state: seen, notified, tracked or gone")
+	fs.StringVar((*string)(&f.status), "status", "", "only auctions with this status: aktiv, verschoben, abberaumt or zuschlag")
+	fs.IntVar(&f.maxValue, "max-value", 0, "only edikte with an appraised value up to this amount in EUR")
+	fs.StringVar(&f.place, "place", "", "only edikte whose PLZ/Ort contains this text, e.g. 4020 or Linz")
+	rule := fs.String("rule", "", `only edikte for which this profile rule is true, e.g. 'kategorie in ["UL", "LF"]'`)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := f.compile(*rule); err != nil {
+		return err
+	}
+	db, err := a.database()
+	if err != nil {
+		return err
+	}
+	all, err := db.Edikte(*notified)
+	if err != nil {
+		return err
+	}
+	trackedURLs, err := db.Tracked(time.Now())
+	if err != nil {
+		return err
+	}
+	f.tracked = make(map[string]bool, len(trackedURLs))
+	for _, u := range trackedURLs {
+		f.tracked[u] = true
+	}
+
+	fmt.Printf("%-16s %-9s %-10s %10s  %-24s %s\n", "ID", "STATE", "STATUS", "SCHÄTZWERT", "PLZ/ORT", "URL")
+	for _, e := range all {
+		if !f.match(e) {
+			continue
+		}
+		status, value, place := "–", "–", "–"
+		if e.Rec != nil {
+			status, value, place = orDash(e.Rec.Status.String()), strconv.Itoa(e.Rec.Schaetzwert), orDash(e.Rec.PlzOrt)
+		}
+		fmt.Printf("%-16s %-9s %-10s %10s  %-24s %s\n", e.ID, listState(e), status, value, place, e.URL)
+	}
+	return nil
+}
+
+// listFilter selects the stored edikte of the list command; zero fields select everything.
+// The record filters reject edikte that were never fetched.
+type listFilter struct {
+	state    string          // "seen", "notified", "tracked" or "gone", see listState
+	status   Status          // auction status
+	maxValue int             // maximum appraised value
+	place    string          // part of PLZ/Ort, case-insensitive
+	rule     *expr.Program   // profile rule, see ruleFields; fields without a value reject
+	tracked  map[string]bool // URLs of the tracked edikte, see DB.Tracked
+}
+
+// compile validates the state and status and compiles rule.
+func (f *listFilter) compile(rule string) error {
+	switch f.state {
+	case "", "seen", "notified", "tracked", "gone":
+	default:
+		return fmt.Errorf("unknown state %q, want seen, notified, tracked or gone", f.state)
+	}
+	if _, ok := statusNames[f.status]; f.status != "" && !ok {
+		return fmt.Errorf("unknown status %q, want aktiv, verschoben, abberaumt or zuschlag", f.status)
+	}
+	if rule != "" {
+		prog, err := expr.Compile(rule, ruleFields)
+		if err != nil {
+			return fmt.Errorf("rule: %w", err)
+		}
+		f.rule = prog
+	}
+	return nil
+}
+
+// match reports whether e passes every filter.
+func (f *listFilter) match(e *StoredEdikt) bool {
+	switch f.state {
+	case "":
+	case "tracked":
+		if !f.tracked[e.URL] {
+			return false
+		}
+	default:
+		if listState(e) != f.state {
+			return false
+		}
+	}
+	if f.status == "" && f.maxValue == 0 && f.place == "" && f.rule == nil {
+		return true
+	}
+	if e.Rec == nil {
+		return false
+	}
+	switch {
+	case f.status != "" && e.Rec.Status != f.status:
+		return false
+	case f.maxValue > 0 && e.Rec.Schaetzwert > f.maxValue:
+		return false
+	case f.place != "" && !strings.Contains(strings.ToLower(e.Rec.PlzOrt), strings.ToLower(f.place)):
+		return false
+	}
+	if f.rule != nil {
+		ok, err := f.rule.Eval(ruleValues(e.Rec, nil))
+		return ok && err == nil
+	}
+	return true
+}
+
+// listState returns "gone", "notified" or "seen" for e.
+func listState(e *StoredEdikt) string {
+	switch {
+	case !e.GoneAt.IsZero():
+		return "gone"
+	case !e.NotifiedAt.IsZero():
+		return "notified"
+	}
+	return "seen"
+}
+
+func cmdShow(_ context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return usageError("show", "<id|url>")
+	}
+	db, err := a.database()
+	if err != nil {
+		return err
+	}
+	e, err := storedEdikt(db, args[0])
+	if err != nil {
+		return err
+	}
+	recipients, err := db.Recipients(e.URL)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Edikt", e.URL)
+	fmt.Printf("  %-14s %s\n", "ID:", e.ID)
+	fmt.Printf("  %-14s %s\n", "first seen:", explainTime(e.FirstSeen.Local(), time.DateTime))
+	fmt.Printf("  %-14s %s\n", "last fetched:", explainTime(e.LastFetched.Local(), time.DateTime))
+	fmt.Printf("  %-14s %s\n", "notified:", explainTime(e.NotifiedAt.Local(), time.DateTime))
+	fmt.Printf("  %-14s %s\n", "gone:", explainTime(e.GoneAt.Local(), time.DateTime))
+	fmt.Printf("  %-14s %s\n", "recipients:", orDash(strings.Join(recipients, ", ")))
+	if e.Rec == nil {
+		fmt.Println("\nNever fetched.")
+		return nil
+	}
+	b, err := json.MarshalIndent(e.Rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\n%s\n", b)
+	return nil
+}
+
+// storedEdikt returns the stored edikt given by ID or URL, see DB.Resolve.
+func storedEdikt(db *DB, urlOrID string) (*StoredEdikt, error) {
+	u, err := db.Resolve(urlOrID)
+	if err != nil {
+		return nil, err
+	}
+	if u == "" {
+		return nil, fmt.Errorf("unknown edikt %q", urlOrID)
+	}
+	return db.Edikt(u)
+}
+
+func cmdExport(_ context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "json", "json (all fields) or csv (key figures)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != "json" && *format != "csv" {
+		return fmt.Errorf("unknown export format %q, want json or csv", *format)
+	}
+	db, err := a.database()
+	if err != nil {
+		return err
+	}
+	all, err := db.Edikte(false)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(all)
+	}
+
+	// CSV with the typed key figures; times in RFC 3339 like in the DB.
+	w := csv.NewWriter(os.Stdout)
+	_ = w.Write([]string{"id", "url", "first_seen", "last_fetched", "notified_at", "gone_at",
+		"dienststelle", "kategorie", "status", "versteigerungstermin", "schaetzwert",
+		"objektgroesse", "grundstuecksgroesse", "plz_ort", "adresse"})
+	csvTime := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	for _, e := range all {
+		row := []string{e.ID, e.URL, csvTime(e.FirstSeen), csvTime(e.LastFetched), csvTime(e.NotifiedAt), csvTime(e.GoneAt)}
+		if r := e.Rec; r != nil {
+			row = append(row, r.Dienststelle, r.Kategorie, string(r.Status), csvTime(r.Versteigerungstermin),
+				strconv.Itoa(r.Schaetzwert), strconv.Itoa(r.Objektgroesse), strconv.Itoa(r.Grundstuecksgroesse),
+				r.PlzOrt, r.Liegenschaftsadresse)
+		}
+		_ = w.Write(row)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func cmdForget(_ context.Context, a *app, args []string) error {
+	if len(args) != 1 {
+		return usageError("forget", "<id|url>")
+	}
+	db, err := a.database()
+	if err != nil {
+		return err
+	}
+	e, err := storedEdikt(db, args[0])
+	if err != nil {
+		return err
+	}
+	if _, err := db.Forget(e.URL); err != nil {
+		return err
+	}
+	fmt.Println("Forgot", e.URL)
+	return nil
+}
+
+func cmdDBMigrate(_ context.Context, a *app, args []string) error {
+	if len(args) > 1 {
+		return usageError("db migrate", "[file]")
+	}
+	path := legacyDBPath
+	if len(args) == 1 {
+		path = args[0]
+	}
+	db, err := a.database()
+	if err != nil {
+		return err
+	}
+	n, err := db.MigrateLegacy(path)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Migrated", n, "edikte from", path, "into", a.dbPath)
+	return nil
+}
+
+func cmdConfigCheck(_ context.Context, a *app, args []string) error {
+	if len(args) > 0 {
+		return usageError("config check", "")
+	}
+
+	// A check never creates missing files, unlike a run.
+	if _, err := os.Stat(a.configPath); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("config %s is missing; a run creates it with a default profile", a.configPath)
+	}
+
+	// Loading validates categories, retry classes and compiles the rules.
+	cfg, err := a.config()
+	if err != nil {
+		return err
+	}
+	for _, p := range cfg.Profiles {
+		state := ""
+		if p.Disabled {
+			state = " (disabled)"
+		}
+		fmt.Printf("Profile %q%s: %d categories, %d rules, home %q\n", p.Name, state, len(p.Categories), len(p.rules), p.Home)
+	}
+
+	mailCfg, err := email.LoadMailConfig()
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("mail config %s is missing; a run creates it with dummy values", a.mailPath)
+	}
+	if err != nil {
+		return err
+	}
+	if mailCfg.Host == "" || mailCfg.Port == 0 {
+		return fmt.Errorf("%s: missing host or port", a.mailPath)
+	}
+	for _, p := range cfg.Profiles {
+		if !p.Disabled && len(p.Recipients) == 0 && len(mailCfg.To) == 0 {
+			return fmt.Errorf("%s: profile %q has no recipients and \"to\" is empty", a.mailPath, p.Name)
+		}
+	}
+	fmt.Printf("Mail to %q, cc %q, bcc %q\n", mailCfg.To, mailCfg.Cc, mailCfg.Bcc)
+	fmt.Println("Config", a.configPath, "and mail config", a.mailPath, "are valid")
+	return nil
+}
+
+func cmdTemplateCheck(_ context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("template check", flag.ContinueOnError)
+	htmlFile := fs.String("html", "", "also write the HTML body to this file, e.g. to open it in a browser")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Loading the config parses the templates of TemplateConfig.Dir.
+	cfg, err := a.config()
+	if err != nil {
+		return err
+	}
+	subject, text, html, err := cfg.templates.render(sampleMailData())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Subject: %s\n\n%s\n", subject, text)
+	if *htmlFile != "" {
+		if err := os.WriteFile(*htmlFile, []byte(html), 0o644); err != nil {
+			return err
+		}
+		fmt.Println("Wrote HTML body to", *htmlFile)
+	}
+	fmt.Printf("Templates are valid, HTML body has %d bytes\n", len(html))
+	return nil
+}
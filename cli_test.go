@@ -0,0 +1,63 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestListFilter(t *testing.T) {
+	linz := &StoredEdikt{URL: "linz", EdiktState: EdiktState{NotifiedAt: time.Now()},
+		Rec: &EdiktRecord{Status: StatusAktiv, Schaetzwert: 25000, PlzOrt: "4020 Linz", Kategorie: "Unbebaute Liegenschaften (UL)"}}
+	wels := &StoredEdikt{URL: "wels", EdiktState: EdiktState{NotifiedAt: time.Now(), GoneAt: time.Now()},
+		Rec: &EdiktRecord{Status: StatusZuschlag, Schaetzwert: 90000, PlzOrt: "4600 Wels"}}
+	unfetched := &StoredEdikt{URL: "unfetched"}
+	all := []*StoredEdikt{linz, wels, unfetched}
+
+	tests := []struct {
+		name   string
+		filter listFilter
+		rule   string
+		want   []string
+	}{
+		{"no filter", listFilter{}, "", []string{"linz", "wels", "unfetched"}},
+		{"seen", listFilter{state: "seen"}, "", []string{"unfetched"}},
+		{"notified", listFilter{state: "notified"}, "", []string{"linz"}},
+		{"gone", listFilter{state: "gone"}, "", []string{"wels"}},
+		{"tracked", listFilter{state: "tracked"}, "", []string{"linz"}},
+		{"status", listFilter{status: StatusZuschlag}, "", []string{"wels"}},
+		{"max value", listFilter{maxValue: 30000}, "", []string{"linz"}},
+		{"place", listFilter{place: "wels"}, "", []string{"wels"}},
+		{"rule", listFilter{}, `kategorie == "UL" && schaetzwert < 30000`, []string{"linz"}},
+		{"rule without value", listFilter{}, `entfernung_km < 50`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.filter
+			if err := f.compile(tt.rule); err != nil {
+				t.Fatal(err)
+			}
+			f.tracked = map[string]bool{"linz": true}
+			var got []string
+			for _, e := range all {
+				if f.match(e) {
+					got = append(got, e.URL)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("listed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListFilterCompile(t *testing.T) {
+	for _, f := range []listFilter{{state: "new"}, {status: "sold"}} {
+		if err := f.compile(""); err == nil {
+			t.Errorf("compile(%+v): no error", f)
+		}
+	}
+	if err := (&listFilter{}).compile("preis < 1"); err == nil {
+		t.Error("compile with unknown rule field: no error")
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"ediktscraper/expr"
+	"ediktscraper/retry"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// defaultConfigPath is the config file unless the -config flag names another.
+const defaultConfigPath = "config.json"
+
+// errConfigCreated is returned by LoadOrInitConfig after writing a default config file.
+var errConfigCreated = errors.New("config file created with default values, please edit it")
+
+// Config is the content of the config file, see LoadOrInitConfig.
+type Config struct {
+	Pipeline  PipelineConfig `json:"pipeline"`
+	Cache     CacheConfig    `json:"cache"`
+	Retry     RetryConfig    `json:"retry"`
+	Archive   ArchiveConfig  `json:"archive"`
+	Templates TemplateConfig `json:"templates"`
+	Profiles  []Profile      `json:"profiles"`
+
+	templates *mailTemplates // parsed Templates, set by LoadOrInitConfig
+}
+
+// RetryConfig configures the retry policy for the portal and for Nominatim.
+// Zero values fall back to retry.Default.
+type RetryConfig struct {
+	MaxAttempts int      `json:"max_attempts"` // total attempts per request including the first
+	BaseDelay   Duration `json:"base_delay"`   // delay before the first retry, doubled for each further retry
+	MaxDelay    Duration `json:"max_delay"`    // cap for a single delay; longer Retry-After values are not awaited
+	Statuses    []int    `json:"statuses"`     // retryable HTTP status codes, e.g. [429, 502, 503, 504]
+	Errors      []string `json:"errors"`       // retryable error classes: "timeout", "connection", "eof"
+}
+
+// Policy converts the config into a retry.Policy.
+func (c RetryConfig) Policy() retry.Policy {
+	p := retry.Default
+	if c.MaxAttempts > 0 {
+		p.MaxAttempts = c.MaxAttempts
+	}
+	if c.BaseDelay > 0 {
+		p.BaseDelay = time.Duration(c.BaseDelay)
+	}
+	if c.MaxDelay > 0 {
+		p.MaxDelay = time.Duration(c.MaxDelay)
+	}
+	if c.Statuses != nil {
+		p.RetryStatuses = c.Statuses
+	}
+	if c.Errors != nil {
+		p.RetryErrors = c.Errors
+	}
+	return p
+}
+
+// CacheConfig configures the on-disk HTTP cache used by Request.
+// An empty Dir disables the cache.
+type CacheConfig struct {
+	Dir         string   `json:"dir"`          // cache directory, e.g. "cache"
+	MaxSizeMB   int      `json:"max_size_mb"`  // total size of cached bodies before eviction; 0 is unbounded
+	ListingTTL  Duration `json:"listing_ttl"`  // search result pages
+	DetailTTL   Duration `json:"detail_ttl"`   // edikt detail pages
+	DocumentTTL Duration `json:"document_ttl"` // Kurz- and Langgutachten documents
+}
+
+// defaultCacheConfig saves most requests while developing and still sees daily changes.
+var defaultCacheConfig = CacheConfig{
+	Dir:         "cache",
+	MaxSizeMB:   512,
+	ListingTTL:  Duration(time.Hour),
+	DetailTTL:   Duration(12 * time.Hour),
+	DocumentTTL: Duration(30 * 24 * time.Hour),
+}
+
+// ArchiveConfig configures the local document archive of alerted edikte.
+// An empty Dir disables the archive.
+type ArchiveConfig struct {
+	Dir       string `json:"dir"`         // archive directory, e.g. "archive"
+	MaxSizeMB int    `json:"max_size_mb"` // maximum size of a single document; 0 is unbounded
+}
+
+// defaultArchiveConfig accepts typical appraisals including scanned plans and photos.
+var defaultArchiveConfig = ArchiveConfig{
+	Dir:       "archive",
+	MaxSizeMB: 100,
+}
+
+// PipelineConfig tunes the concurrency of a run.
+// Zero values fall back to the defaults in defaultPipelineConfig.
+type PipelineConfig struct {
+	ListingWorkers int      `json:"listing_workers"` // concurrent search result page downloads
+	DetailWorkers  int      `json:"detail_workers"`  // concurrent detail page downloads
+	EnrichWorkers  int      `json:"enrich_workers"`  // concurrent geocoding lookups (Nominatim is limited to 1 req/s anyway)
+	HostInterval   Duration `json:"host_interval"`   // minimum delay between two requests to the same host, e.g. "250ms"
+	Refresh        Duration `json:"refresh"`         // re-fetch known detail pages after this interval, e.g. "168h"
+}
+
+// defaultPipelineConfig is polite towards the portal and still much faster than sequential fetching.
+var defaultPipelineConfig = PipelineConfig{
+	ListingWorkers: 2,
+	DetailWorkers:  4,
+	EnrichWorkers:  2,
+	HostInterval:   Duration(250 * time.Millisecond),
+	Refresh:        Duration(7 * 24 * time.Hour),
+}
+
+// withDefaults returns c with zero values replaced by defaultPipelineConfig.
+func (c PipelineConfig) withDefaults() PipelineConfig {
+	if c.ListingWorkers <= 0 {
+		c.ListingWorkers = defaultPipelineConfig.ListingWorkers
+	}
+	if c.DetailWorkers <= 0 {
+		c.DetailWorkers = defaultPipelineConfig.DetailWorkers
+	}
+	if c.EnrichWorkers <= 0 {
+		c.EnrichWorkers = defaultPipelineConfig.EnrichWorkers
+	}
+	if c.HostInterval <= 0 {
+		c.HostInterval = defaultPipelineConfig.HostInterval
+	}
+	if c.Refresh <= 0 {
+		c.Refresh = defaultPipelineConfig.Refresh
+	}
+	return c
+}
+
+// Duration is a time.Duration that is written as a string like "250ms" or "24h" in JSON.
+type Duration time.Duration
+
+// MarshalText encodes the duration in time.Duration.String format.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText parses a duration in time.ParseDuration format.
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Profile is one named search: which categories to query, which items to accept,
+// where distances are measured from and who gets notified.
+// Zero values for limits mean "no limit". Rules are checked in addition to the limits.
+type Profile struct {
+	Name          string       `json:"name"`
+	Disabled      bool         `json:"disabled,omitempty"`
+	Categories    []Category   `json:"categories"`              // VKat codes, e.g. "UL", "LF"; at least one
+	Bundeslaender []Bundesland `json:"bundeslaender,omitempty"` // federal states by name, e.g. "Steiermark"
+	Dienststelle  string       `json:"dienststelle,omitempty"`  // court, e.g. "BG Linz"
+	FullText      string       `json:"fulltext,omitempty"`      // free-text search term
+	MinPrice      int          `json:"min_price"`               // minimum Schätzwert in EUR
+	MaxPrice      int          `json:"max_price"`               // maximum Schätzwert in EUR
+	MinSize       int          `json:"min_size"`                // minimum size in m², see Profile.size
+	MaxSize       int          `json:"max_size"`                // maximum size in m², see Profile.size
+	MaxDistanceKm int          `json:"max_distance_km"`         // maximum distance from Home
+	Home          string       `json:"home"`                    // origin for distances, e.g. "4020 Linz"
+	Recipients    []string     `json:"recipients"`              // mail addresses; empty uses "to" from mail.conf
+	Rules         []string     `json:"rules,omitempty"`         // filter expressions that must all be true, see ruleFields
+
+	rules []*expr.Program // compiled Rules, set by LoadOrInitConfig
+}
+
+// Queries returns one search query per configured category.
+// Separate queries keep each result list small and below the portal's SearchMax.
+func (p Profile) Queries() []SearchQuery {
+	queries := make([]SearchQuery, 0, len(p.Categories))
+	for _, cat := range p.Categories {
+		queries = append(queries, SearchQuery{
+			Categories:    []Category{cat},
+			Bundeslaender: p.Bundeslaender,
+			Dienststelle:  p.Dienststelle,
+			FullText:      p.FullText,
+		})
+	}
+	return queries
+}
+
+// MatchListing applies the limits that can be decided from a search result row alone,
+// so rejected items never cost a detail fetch. Fields the row does not show always pass.
+func (p Profile) MatchListing(e ListingEntry) (reason string, ok bool) {
+	if e.Kategorie != "" && len(p.Categories) > 0 && !slices.Contains(p.Categories, e.Kategorie) {
+		return "Category", false
+	}
+	if p.Dienststelle != "" && e.Dienststelle != "" &&
+		!strings.Contains(strings.ToLower(e.Dienststelle), strings.ToLower(p.Dienststelle)) {
+		return "Court", false
+	}
+	return "", true
+}
+
+// Check applies the price and size limits and the rules that need no enrichment to rec.
+// It returns a short reason and false if the record is rejected.
+// The distance limit is checked separately by CheckDistance because it needs a network lookup;
+// rules that use enriched fields are checked by CheckRules once these are known.
+func (p Profile) Check(rec *EdiktRecord) (reason string, ok bool) {
+	if reason, ok := p.checkLimits(rec); !ok {
+		return reason, false
+	}
+	return p.CheckRules(ruleValues(rec, nil), true)
+}
+
+// checkLimits applies the price and size limits to rec.
+func (p Profile) checkLimits(rec *EdiktRecord) (reason string, ok bool) {
+	sw := rec.Schaetzwert
+	if p.MinPrice > 0 && sw < p.MinPrice {
+		return "Cheap", false
+	}
+	if p.MaxPrice > 0 && sw > p.MaxPrice {
+		return "Expensive", false
+	}
+
+	size := p.size(rec)
+	if p.MinSize > 0 && size < p.MinSize {
+		return "Small", false
+	}
+	if p.MaxSize > 0 && size > p.MaxSize {
+		return "Large", false
+	}
+	return "", true
+}
+
+// CheckDistance applies the distance limit to a distance in km.
+// Distances are computed in the enrichment stage from the geocoded PLZ/Ort and Home.
+func (p Profile) CheckDistance(km int) (reason string, ok bool) {
+	if p.MaxDistanceKm > 0 && km > p.MaxDistanceKm {
+		return "Far", false
+	}
+	return "", true
+}
+
+// size returns the size the limits apply to: the lot size ("Grundstücksgröße"),
+// or the object size ("Objektgröße") for items without a lot, e.g. apartments.
+func (p Profile) size(rec *EdiktRecord) int {
+	if rec.Grundstuecksgroesse > 0 {
+		return rec.Grundstuecksgroesse
+	}
+	return rec.Objektgroesse
+}
+
+// ------------------------------------------------------------------------------------------------------------------ //
+
+// LoadOrInitConfig reads the config file at path.
+// If it does not exist, it writes a default profile (the former hardcoded search) and returns errConfigCreated to force editing.
+func LoadOrInitConfig(path string) (*Config, error) {
+
+	// Try to read existing config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Create with the previous built-in search: buildable lots and
+			// agricultural/forest land up to 30000 EUR, distances from Linz.
+			dummy := Config{
+				Pipeline: defaultPipelineConfig,
+				Cache:    defaultCacheConfig,
+				Archive:  defaultArchiveConfig,
+				Retry: RetryConfig{
+					MaxAttempts: retry.Default.MaxAttempts,
+					BaseDelay:   Duration(retry.Default.BaseDelay),
+					MaxDelay:    Duration(retry.Default.MaxDelay),
+					Statuses:    retry.Default.RetryStatuses,
+					Errors:      retry.Default.RetryErrors,
+				},
+				Profiles: []Profile{{
+					Name:       "default",
+					Categories: []Category{CategoryUnbebaut, CategoryLandForst},
+					MaxPrice:   30000,
+					Home:       "4020 Linz",
+				}},
+			}
+			b, _ := json.MarshalIndent(dummy, "", "  ")
+			if err := os.WriteFile(path, b, 0o600); err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%s: %w", path, errConfigCreated)
+		}
+		return nil, err
+	}
+
+	// Decode JSON
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+
+	// Fill in missing pipeline settings.
+	cfg.Pipeline = cfg.Pipeline.withDefaults()
+
+	// Parse the mail templates now, so syntax errors show before any request.
+	if cfg.templates, err = loadTemplates(cfg.Templates.Dir); err != nil {
+		return nil, fmt.Errorf("%s: templates: %w", path, err)
+	}
+
+	// Reject unknown retry error classes, they would silently never match.
+	for _, class := range cfg.Retry.Errors {
+		if class != retry.ErrorTimeout && class != retry.ErrorConnection && class != retry.ErrorEOF {
+			return nil, fmt.Errorf("%s: retry: unknown error class %q", path, class)
+		}
+	}
+
+	// Reject missing and unknown category codes, they would silently search nothing.
+	// Every profile needs a home, distances are part of each report.
+	// Rules are compiled once here, so typos are reported before any request.
+	for i, p := range cfg.Profiles {
+		if p.Home == "" {
+			return nil, fmt.Errorf("%s: profile %q: missing home", path, p.Name)
+		}
+		if len(p.Categories) == 0 {
+			return nil, fmt.Errorf("%s: profile %q: missing categories, the search needs at least one", path, p.Name)
+		}
+		for _, c := range p.Categories {
+			if !c.Valid() {
+				return nil, fmt.Errorf("%s: profile %q: unknown category %q", path, p.Name, c)
+			}
+		}
+		rules, err := compileRules(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: profile %q: %w", path, p.Name, err)
+		}
+		cfg.Profiles[i].rules = rules
+	}
+
+	return &cfg, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigValidation(t *testing.T) {
+	tests := []struct {
+		profile string
+		wantErr string
+	}{
+		{`{"name": "a", "categories": ["UL"], "home": "4020 Linz"}`, ""},
+		{`{"name": "a", "categories": [], "home": "4020 Linz"}`, `profile "a": missing categories`},
+		{`{"name": "a", "home": "4020 Linz"}`, `profile "a": missing categories`},
+		{`{"name": "a", "categories": ["XX"], "home": "4020 Linz"}`, `unknown category "XX"`},
+		{`{"name": "a", "categories": ["UL"]}`, "missing home"},
+		{`{"name": "a", "categories": ["UL"], "home": "4020 Linz", "rules": ["preis < 1"]}`, `rule 1`},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, []byte(`{"profiles": [`+tt.profile+`]}`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := LoadOrInitConfig(path)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("profile %s: error %v, want %q", tt.profile, err, tt.wantErr)
+		}
+	}
+}
@@ -1,59 +1,569 @@
 package main
 
 import (
+	"database/sql"
+	"ediktscraper/openstreetmap"
 	"encoding/gob"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/url"
 	"os"
+	"slices"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // pure-Go SQLite driver "sqlite"
 )
 
-const dbPath = "db.dat"
+const (
+	defaultDBPath = "edikte.db" // database unless the -db flag names another
+	legacyDBPath  = "db.dat"    // gob file of earlier versions, imported by "run" or "db migrate"
+)
 
+// DB is the persistent state between runs, an SQLite database with the tables
+//   - edikte: one row per alldoc URL with the latest record, the time of the last
+//     successful detail fetch, the time it was first notified and the time it
+//     disappeared from the portal,
+//   - observations: every successful detail fetch with its field values,
+//   - documents: the archived documents of each edikt (see archive),
+//   - geocodes: Nominatim results by query (see openstreetmap.Store),
+//   - notifications: every mail sent per edikt, profile and recipient.
+//
+// Times are stored as RFC 3339 strings in UTC, so they sort and compare as text and work
+// with SQLite's date functions. A DB is safe for concurrent use.
 type DB struct {
-	Edikt map[string]bool
+	sql *sql.DB
+}
+
+// migrations bring the schema up to date. migrations[i] upgrades a database with
+// PRAGMA user_version i to version i+1; new versions are only ever appended.
+var migrations = []string{
+	// 1: initial schema.
+	`
+CREATE TABLE IF NOT EXISTS edikte (
+	url          TEXT PRIMARY KEY,
+	id           TEXT NOT NULL,    -- EdiktRecord.ID
+	first_seen   TEXT NOT NULL,
+	last_fetched TEXT,             -- last successful detail fetch, NULL if never fetched
+	notified_at  TEXT,             -- first notification, NULL if never notified
+	record       TEXT              -- latest EdiktRecord as JSON
+);
+CREATE INDEX IF NOT EXISTS edikte_id ON edikte(id);
+
+CREATE TABLE IF NOT EXISTS observations (
+	id                   INTEGER PRIMARY KEY,
+	url                  TEXT NOT NULL REFERENCES edikte(url),
+	observed_at          TEXT NOT NULL,
+	dienststelle         TEXT,
+	kategorie            TEXT,
+	plz_ort              TEXT,
+	schaetzwert          INTEGER,
+	objektgroesse        INTEGER,
+	grundstuecksgroesse  INTEGER,
+	versteigerungstermin TEXT,
+	record               TEXT NOT NULL -- EdiktRecord as JSON
+);
+CREATE INDEX IF NOT EXISTS observations_url ON observations(url, observed_at);
+
+CREATE TABLE IF NOT EXISTS documents (
+	edikt_url    TEXT NOT NULL REFERENCES edikte(url),
+	url          TEXT NOT NULL,
+	file         TEXT NOT NULL,
+	content_type TEXT,
+	size         INTEGER NOT NULL,
+	sha256       TEXT NOT NULL,
+	text_file    TEXT,
+	fetched_at   TEXT NOT NULL,
+	PRIMARY KEY (edikt_url, url)
+);
+
+CREATE TABLE IF NOT EXISTS geocodes (
+	query      TEXT PRIMARY KEY,
+	lat        REAL NOT NULL,
+	lon        REAL NOT NULL,
+	updated_at TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS notifications (
+	id        INTEGER PRIMARY KEY,
+	url       TEXT NOT NULL REFERENCES edikte(url),
+	profile   TEXT NOT NULL,
+	recipient TEXT NOT NULL,
+	sent_at   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS notifications_url ON notifications(url);
+`,
+
+	// 2: end change tracking of edikte that were removed from the portal.
+	`ALTER TABLE edikte ADD COLUMN gone_at TEXT;`,
+
+	// 3: auction status, see Status.
+	`ALTER TABLE observations ADD COLUMN status TEXT;`,
+}
+
+// OpenDB opens or creates the database at path.
+func OpenDB(path string) (*DB, error) {
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() +
+		"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)"
+	conn, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows one writer at a time; a single connection avoids SQLITE_BUSY between workers.
+	conn.SetMaxOpenConns(1)
+
+	db := &DB{sql: conn}
+	if err := db.migrate(); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("migrate %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// migrate applies all migrations the database has not seen yet, each in its own transaction.
+func (db *DB) migrate() error {
+	var version int
+	if err := db.sql.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(migrations); version++ {
+		tx, err := db.sql.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("version %d: %w", version+1, err)
+		}
+		// PRAGMA does not take parameters.
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the database.
+func (db *DB) Close() error {
+	return db.sql.Close()
+}
+
+// Notified reports whether alldocURL was mailed to recipient. Edikte notified before
+// recipients were recorded count as mailed to everyone.
+func (db *DB) Notified(alldocURL, recipient string) (bool, error) {
+	var notified bool
+	err := db.sql.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM notifications WHERE url = ? AND recipient = ?)
+			OR EXISTS (SELECT 1 FROM edikte WHERE url = ? AND notified_at IS NOT NULL
+				AND NOT EXISTS (SELECT 1 FROM notifications WHERE url = edikte.url))`,
+		alldocURL, recipient, alldocURL).Scan(&notified)
+	if err != nil {
+		return false, fmt.Errorf("lookup notification %s: %w", alldocURL, err)
+	}
+	return notified, nil
+}
+
+// NeedsFetch reports whether the detail page of alldocURL has to be downloaded:
+// either it was never fetched, or the last fetch is older than refresh.
+// Lookup errors count as "needs fetch".
+func (db *DB) NeedsFetch(alldocURL string, refresh time.Duration, now time.Time) bool {
+	var fetched sql.NullString
+	err := db.sql.QueryRow(`SELECT last_fetched FROM edikte WHERE url = ?`, alldocURL).Scan(&fetched)
+	if err != nil || !fetched.Valid {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339, fetched.String)
+	return err != nil || now.Sub(t) >= refresh
+}
+
+// EdiktState is what the DB knows about an edikt, see DB.Edikt.
+// Zero times mean "never".
+type EdiktState struct {
+	FirstSeen   time.Time `json:"first_seen"`
+	LastFetched time.Time `json:"last_fetched,omitzero"` // last successful detail fetch
+	NotifiedAt  time.Time `json:"notified_at,omitzero"`  // first notification; later ones go to new recipients only
+	GoneAt      time.Time `json:"gone_at,omitzero"`      // removed from the portal
+}
+
+// StoredEdikt is a row of the edikte table.
+type StoredEdikt struct {
+	URL string `json:"url"`
+	ID  string `json:"id"` // EdiktRecord.ID
+	EdiktState
+	Rec *EdiktRecord `json:"record,omitempty"` // latest record, nil if never fetched
+}
+
+// ediktColumns are the columns read by scanEdikt.
+const ediktColumns = `url, id, first_seen, last_fetched, notified_at, gone_at, record`
+
+// scanEdikt reads a row of ediktColumns.
+func scanEdikt(row interface{ Scan(dest ...any) error }) (*StoredEdikt, error) {
+	var e StoredEdikt
+	var seen string
+	var fetched, notified, gone, data sql.NullString
+	if err := row.Scan(&e.URL, &e.ID, &seen, &fetched, &notified, &gone, &data); err != nil {
+		return nil, err
+	}
+	e.FirstSeen = parseDBTime(seen)
+	e.LastFetched = parseDBTime(fetched.String)
+	e.NotifiedAt = parseDBTime(notified.String)
+	e.GoneAt = parseDBTime(gone.String)
+	if data.Valid {
+		e.Rec = new(EdiktRecord)
+		if err := json.Unmarshal([]byte(data.String), e.Rec); err != nil {
+			return nil, fmt.Errorf("decode record %s: %w", e.URL, err)
+		}
+	}
+	return &e, nil
+}
+
+// Edikt returns the stored edikt alldocURL, or nil if the DB does not know it.
+// It never writes.
+func (db *DB) Edikt(alldocURL string) (*StoredEdikt, error) {
+	e, err := scanEdikt(db.sql.QueryRow(`SELECT `+ediktColumns+` FROM edikte WHERE url = ?`, alldocURL))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return e, err
+}
+
+// Edikte returns all stored edikte, or only the notified ones, oldest first.
+func (db *DB) Edikte(notifiedOnly bool) ([]*StoredEdikt, error) {
+	query := `SELECT ` + ediktColumns + ` FROM edikte`
+	if notifiedOnly {
+		query += ` WHERE notified_at IS NOT NULL`
+	}
+	rows, err := db.sql.Query(query + ` ORDER BY first_seen, url`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var all []*StoredEdikt
+	for rows.Next() {
+		e, err := scanEdikt(rows)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, e)
+	}
+	return all, rows.Err()
+}
+
+// Resolve returns the alldoc URL of a stored edikt given by URL or by ID (see EdiktRecord.ID),
+// or an empty string if there is none. An ID shared by several URLs is an error.
+func (db *DB) Resolve(urlOrID string) (string, error) {
+	rows, err := db.sql.Query(`SELECT url FROM edikte WHERE url = ? OR id = ? ORDER BY url`,
+		urlOrID, strings.ToLower(urlOrID))
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			return "", err
+		}
+		urls = append(urls, u)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	switch {
+	case len(urls) == 0:
+		return "", nil
+	case len(urls) > 1 && !slices.Contains(urls, urlOrID):
+		return "", fmt.Errorf("%q matches %d edikte, use the URL: %s", urlOrID, len(urls), strings.Join(urls, ", "))
+	case len(urls) > 1:
+		return urlOrID, nil
+	}
+	return urls[0], nil
+}
+
+// Forget deletes alldocURL with its observations, documents and notifications, so the next
+// run treats it as new and mails it again if it matches. Archived files are kept.
+// It returns false if the DB did not know the URL.
+func (db *DB) Forget(alldocURL string) (bool, error) {
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback() // no-op after Commit
+
+	for _, table := range []string{"observations", "notifications"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE url = ?`, alldocURL); err != nil {
+			return false, fmt.Errorf("forget %s: %w", alldocURL, err)
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM documents WHERE edikt_url = ?`, alldocURL); err != nil {
+		return false, fmt.Errorf("forget %s: %w", alldocURL, err)
+	}
+	res, err := tx.Exec(`DELETE FROM edikte WHERE url = ?`, alldocURL)
+	if err != nil {
+		return false, fmt.Errorf("forget %s: %w", alldocURL, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, tx.Commit()
+}
+
+// Observe records a successful detail fetch of rec at time t: it stores rec as the latest
+// record of its edikt and adds an observation with its field values.
+func (db *DB) Observe(rec *EdiktRecord, t time.Time) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	var termin sql.NullString
+	if !rec.Versteigerungstermin.IsZero() {
+		termin = sql.NullString{String: dbTime(rec.Versteigerungstermin), Valid: true}
+	}
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op after Commit
+
+	at := dbTime(t)
+	if _, err := tx.Exec(`
+		INSERT INTO edikte (url, id, first_seen, last_fetched, record) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (url) DO UPDATE SET last_fetched = excluded.last_fetched, record = excluded.record`,
+		rec.URL, rec.ID(), at, at, string(data)); err != nil {
+		return fmt.Errorf("observe %s: %w", rec.URL, err)
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO observations (url, observed_at, dienststelle, kategorie, plz_ort, schaetzwert,
+			objektgroesse, grundstuecksgroesse, versteigerungstermin, status, record)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		rec.URL, at, rec.Dienststelle, rec.Kategorie, rec.PlzOrt, rec.Schaetzwert,
+		rec.Objektgroesse, rec.Grundstuecksgroesse, termin, string(rec.Status), string(data)); err != nil {
+		return fmt.Errorf("observe %s: %w", rec.URL, err)
+	}
+	return tx.Commit()
+}
+
+// Tracked returns the alldoc URLs whose changes are reported: edikte that were notified,
+// are still on the portal, have no final Status and whose auction date is not before now
+// (or unknown), sorted by URL.
+func (db *DB) Tracked(now time.Time) ([]string, error) {
+	rows, err := db.sql.Query(`
+		SELECT url, record FROM edikte
+		WHERE notified_at IS NOT NULL AND gone_at IS NULL
+		ORDER BY url`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var u string
+		var data sql.NullString
+		if err := rows.Scan(&u, &data); err != nil {
+			return nil, err
+		}
+		// The auction date is part of the JSON record; edikte without a record are tracked
+		// until their first fetch shows the date.
+		if data.Valid {
+			var rec EdiktRecord
+			if err := json.Unmarshal([]byte(data.String), &rec); err == nil && (rec.Status.Final() ||
+				!rec.Versteigerungstermin.IsZero() && rec.Versteigerungstermin.Before(now)) {
+				continue
+			}
+		}
+		urls = append(urls, u)
+	}
+	return urls, rows.Err()
 }
 
-// AddEdikt adds the given alldocURL to the set of known entries.
-// It returns true if the URL was already present before this call.
-// The method initializes the map on first use and persists the DB to disk.
-func (db *DB) AddEdikt(alldocURL string) (isKnown bool) {
-	if db.Edikt == nil {
-		db.Edikt = make(map[string]bool)
+// LastRecord returns the latest stored record of alldocURL, or nil if it was never fetched.
+func (db *DB) LastRecord(alldocURL string) (*EdiktRecord, error) {
+	var data sql.NullString
+	err := db.sql.QueryRow(`SELECT record FROM edikte WHERE url = ?`, alldocURL).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !data.Valid) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rec EdiktRecord
+	if err := json.Unmarshal([]byte(data.String), &rec); err != nil {
+		return nil, fmt.Errorf("decode record %s: %w", alldocURL, err)
 	}
-	_, isKnown = db.Edikt[alldocURL]
-	db.Edikt[alldocURL] = true
-	db.Save()
-	return isKnown
+	return &rec, nil
 }
 
-// Save writes the DB to disk at dbPath using gob encoding.
-// It panics on I/O or encoding errors.
-func (db *DB) Save() {
-	f, err := os.Create(dbPath)
+// MarkGone records that alldocURL is no longer on the portal, which ends its change tracking.
+func (db *DB) MarkGone(alldocURL string, t time.Time) error {
+	_, err := db.sql.Exec(`UPDATE edikte SET gone_at = ? WHERE url = ?`, dbTime(t), alldocURL)
+	return err
+}
+
+// Recipients returns everyone who was notified about alldocURL, sorted.
+func (db *DB) Recipients(alldocURL string) ([]string, error) {
+	rows, err := db.sql.Query(`SELECT DISTINCT recipient FROM notifications WHERE url = ? ORDER BY recipient`, alldocURL)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	defer f.Close()
-	if err := gob.NewEncoder(f).Encode(db); err != nil {
-		panic(err)
+	defer rows.Close()
+
+	var recipients []string
+	for rows.Next() {
+		var r string
+		if err := rows.Scan(&r); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
 	}
+	return recipients, rows.Err()
 }
 
-// LoadDB loads a DB from dbPath using gob decoding.
-// If the file does not exist, it returns a new empty DB.
-// It panics on any other error.
-func LoadDB() *DB {
-	f, err := os.Open(dbPath)
+// SaveDocuments replaces the archived documents of the edikt alldocURL with docs.
+func (db *DB) SaveDocuments(alldocURL string, docs []Document) error {
+	tx, err := db.sql.Begin()
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return new(DB)
+		return err
+	}
+	defer tx.Rollback() // no-op after Commit
+
+	if _, err := tx.Exec(`DELETE FROM documents WHERE edikt_url = ?`, alldocURL); err != nil {
+		return err
+	}
+	for _, d := range docs {
+		if _, err := tx.Exec(`
+			INSERT INTO documents (edikt_url, url, file, content_type, size, sha256, text_file, fetched_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			alldocURL, d.URL, d.File, d.ContentType, d.Size, d.SHA256, d.TextFile, dbTime(d.FetchedAt)); err != nil {
+			return fmt.Errorf("save documents %s: %w", alldocURL, err)
 		}
-		panic(err)
 	}
-	defer f.Close()
+	return tx.Commit()
+}
 
-	var db DB
-	if err := gob.NewDecoder(f).Decode(&db); err != nil {
-		panic(err)
+// AddNotification records a mail about alldocURL sent to recipient for profile at time t.
+// The first notification also sets the edikt's NotifiedAt, which starts tracking its changes.
+func (db *DB) AddNotification(alldocURL, profile, recipient string, t time.Time) error {
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
 	}
-	return &db
+	defer tx.Rollback() // no-op after Commit
+
+	at := dbTime(t)
+	if _, err := tx.Exec(`
+		INSERT INTO edikte (url, id, first_seen, notified_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (url) DO UPDATE SET notified_at = excluded.notified_at WHERE notified_at IS NULL`,
+		alldocURL, ediktID(alldocURL), at, at); err != nil {
+		return fmt.Errorf("add notification %s: %w", alldocURL, err)
+	}
+	if _, err := tx.Exec(`INSERT INTO notifications (url, profile, recipient, sent_at) VALUES (?, ?, ?, ?)`,
+		alldocURL, profile, recipient, at); err != nil {
+		return fmt.Errorf("add notification %s: %w", alldocURL, err)
+	}
+	return tx.Commit()
+}
+
+// LookupGeocode implements openstreetmap.Store.
+func (db *DB) LookupGeocode(query string) (p openstreetmap.Point, ok bool) {
+	err := db.sql.QueryRow(`SELECT lat, lon FROM geocodes WHERE query = ?`, query).Scan(&p.Lat, &p.Lon)
+	return p, err == nil
+}
+
+// SaveGeocode implements openstreetmap.Store.
+func (db *DB) SaveGeocode(query string, p openstreetmap.Point) error {
+	_, err := db.sql.Exec(`
+		INSERT INTO geocodes (query, lat, lon, updated_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (query) DO UPDATE SET lat = excluded.lat, lon = excluded.lon, updated_at = excluded.updated_at`,
+		query, p.Lat, p.Lon, dbTime(time.Now()))
+	return err
+}
+
+// legacyDB is the gob-encoded state of earlier versions.
+//   - Edikt holds the alldoc URLs that were already notified.
+//   - Seen holds the time of the last successful detail fetch per alldoc URL.
+type legacyDB struct {
+	Edikt map[string]bool
+	Seen  map[string]time.Time
+}
+
+// MigrateLegacy imports the gob database at path and renames it to path+".migrated",
+// so it is imported only once. Notified URLs keep the migration time as notified_at,
+// because the old format did not record when they were sent.
+// Returns the number of imported URLs.
+func (db *DB) MigrateLegacy(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	var old legacyDB
+	err = gob.NewDecoder(f).Decode(&old)
+	_ = f.Close()
+	if err != nil {
+		return 0, fmt.Errorf("decode %s: %w", path, err)
+	}
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // no-op after Commit
+
+	// Collect every URL of both maps.
+	urls := make(map[string]bool, len(old.Edikt)+len(old.Seen))
+	for u := range old.Edikt {
+		urls[u] = true
+	}
+	for u := range old.Seen {
+		urls[u] = true
+	}
+
+	now := time.Now()
+	for u := range urls {
+		var fetched, notified sql.NullString
+		firstSeen := now
+		if t, ok := old.Seen[u]; ok {
+			fetched = sql.NullString{String: dbTime(t), Valid: true}
+			firstSeen = t
+		}
+		if old.Edikt[u] {
+			notified = sql.NullString{String: dbTime(now), Valid: true}
+		}
+
+		// Existing rows win; they are newer than the legacy file.
+		if _, err := tx.Exec(`
+			INSERT INTO edikte (url, id, first_seen, last_fetched, notified_at) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (url) DO NOTHING`,
+			u, ediktID(u), dbTime(firstSeen), fetched, notified); err != nil {
+			return 0, fmt.Errorf("migrate %s: %w", path, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("migrate %s: %w", path, err)
+	}
+
+	if err := os.Rename(path, path+".migrated"); err != nil {
+		return 0, err
+	}
+	return len(urls), nil
+}
+
+// dbTime formats t for storage, see DB.
+func dbTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// parseDBTime parses a time stored by dbTime; empty or invalid values are the zero time.
+func parseDBTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
 }
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Alldoc URLs of the tests.
+const (
+	testURL1 = "https://edikte.justiz.gv.at/edikte/ex/exedi3.nsf/alldoc/0123456789abcdef!OpenDocument"
+	testURL2 = "https://edikte.justiz.gv.at/edikte/ex/exedi3.nsf/alldoc/fedcba9876543210!OpenDocument"
+	testURL3 = "https://edikte.justiz.gv.at/edikte/ex/exedi3.nsf/alldoc/00000000000000aa!OpenDocument"
+)
+
+// openTestDB opens a new database in a temporary directory.
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := OpenDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+// TestNotified checks that a match stays new to every recipient that was not mailed,
+// and that the first mail marks the edikt notified.
+func TestNotified(t *testing.T) {
+	db := openTestDB(t)
+
+	const (
+		link   = testURL1
+		legacy = testURL2
+		anna   = "anna@example.com"
+		bernd  = "bernd@example.com"
+	)
+	notified := func(link, recipient string) bool {
+		t.Helper()
+		ok, err := db.Notified(link, recipient)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+
+	// Nothing was sent yet, e.g. because the mail failed.
+	if notified(link, anna) || notified(link, bernd) {
+		t.Fatal("unsent edikt is notified")
+	}
+	if e, err := db.Edikt(link); err != nil || e != nil {
+		t.Fatalf("Edikt before the first mail = %+v, %v; want nil", e, err)
+	}
+
+	// Anna got the mail, Bernd did not.
+	sentAt := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	if err := db.AddNotification(link, "linz", anna, sentAt); err != nil {
+		t.Fatal(err)
+	}
+	if !notified(link, anna) || notified(link, bernd) {
+		t.Errorf("after mailing anna: anna %v, bernd %v; want true, false", notified(link, anna), notified(link, bernd))
+	}
+
+	// A later mail keeps the time of the first.
+	if err := db.AddNotification(link, "linz", bernd, sentAt.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	e, err := db.Edikt(link)
+	if err != nil || e == nil {
+		t.Fatalf("Edikt = %+v, %v", e, err)
+	}
+	if !e.NotifiedAt.Equal(sentAt) {
+		t.Errorf("NotifiedAt = %v, want %v", e.NotifiedAt, sentAt)
+	}
+	if !notified(link, bernd) {
+		t.Error("bernd not notified after his mail")
+	}
+
+	// Edikte notified before recipients were recorded count as sent to everyone.
+	if _, err := db.sql.Exec(`INSERT INTO edikte (url, id, first_seen, notified_at) VALUES (?, ?, ?, ?)`,
+		legacy, ediktID(legacy), dbTime(sentAt), dbTime(sentAt)); err != nil {
+		t.Fatal(err)
+	}
+	if !notified(legacy, anna) {
+		t.Error("legacy edikt not notified")
+	}
+}
+
+func TestObserve(t *testing.T) {
+	db := openTestDB(t)
+	first := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	second := first.Add(24 * time.Hour)
+
+	rec := &EdiktRecord{URL: testURL1, Schaetzwert: 25000, PlzOrt: "4020 Linz", Status: StatusAktiv}
+	if err := db.Observe(rec, first); err != nil {
+		t.Fatal(err)
+	}
+	rec2 := *rec
+	rec2.Schaetzwert, rec2.Status = 20000, StatusVerschoben
+	if err := db.Observe(&rec2, second); err != nil {
+		t.Fatal(err)
+	}
+
+	// The edikt keeps its first sighting and gets the latest record.
+	e, err := db.Edikt(testURL1)
+	if err != nil || e == nil {
+		t.Fatalf("Edikt = %+v, %v", e, err)
+	}
+	if !e.FirstSeen.Equal(first) || !e.LastFetched.Equal(second) {
+		t.Errorf("first seen %v, last fetched %v; want %v, %v", e.FirstSeen, e.LastFetched, first, second)
+	}
+	if e.ID != "0123456789abcdef" || e.Rec == nil || e.Rec.Schaetzwert != 20000 {
+		t.Errorf("edikt = %+v, want ID 0123456789abcdef and the second record", e)
+	}
+
+	// Every fetch is an observation with its field values.
+	rows, err := db.sql.Query(`SELECT observed_at, schaetzwert, status FROM observations WHERE url = ? ORDER BY observed_at`, testURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var at, status string
+		var value int
+		if err := rows.Scan(&at, &value, &status); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, fmt.Sprintf("%s %d %s", at, value, status))
+	}
+	want := []string{"2026-05-01T08:00:00Z 25000 aktiv", "2026-05-02T08:00:00Z 20000 verschoben"}
+	if !slices.Equal(got, want) {
+		t.Errorf("observations = %q, want %q", got, want)
+	}
+}
+
+func TestNeedsFetch(t *testing.T) {
+	db := openTestDB(t)
+	fetched := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	if err := db.Observe(&EdiktRecord{URL: testURL1}, fetched); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		url     string
+		refresh time.Duration
+		now     time.Time
+		want    bool
+	}{
+		{testURL2, time.Hour, fetched, true}, // unknown
+		{testURL1, 2 * time.Hour, fetched.Add(time.Hour), false},
+		{testURL1, 2 * time.Hour, fetched.Add(2 * time.Hour), true},
+		{testURL1, 0, fetched, true},
+	}
+	for _, tt := range tests {
+		if got := db.NeedsFetch(tt.url, tt.refresh, tt.now); got != tt.want {
+			t.Errorf("NeedsFetch(%s, %v, +%v) = %v, want %v", ediktID(tt.url), tt.refresh, tt.now.Sub(fetched), got, tt.want)
+		}
+	}
+}
+
+func TestTracked(t *testing.T) {
+	db := openTestDB(t)
+	now := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	link := func(id string) string {
+		return "https://edikte.justiz.gv.at/edikte/ex/exedi3.nsf/alldoc/" + id + "!OpenDocument"
+	}
+
+	tests := []struct {
+		id       string
+		rec      *EdiktRecord // nil if never fetched
+		notified bool
+		gone     bool
+		want     bool
+	}{
+		{"a1", &EdiktRecord{Status: StatusAktiv, Versteigerungstermin: now.Add(24 * time.Hour)}, true, false, true},
+		{"a2", &EdiktRecord{Status: StatusVerschoben}, true, false, true}, // date unknown
+		{"a3", nil, true, false, true},
+		{"a4", &EdiktRecord{Status: StatusAktiv}, false, false, false},
+		{"a5", &EdiktRecord{Status: StatusZuschlag, Versteigerungstermin: now.Add(24 * time.Hour)}, true, false, false},
+		{"a6", &EdiktRecord{Status: StatusAbberaumt}, true, false, false},
+		{"a7", &EdiktRecord{Status: StatusAktiv, Versteigerungstermin: now.Add(-time.Hour)}, true, false, false},
+		{"a8", &EdiktRecord{Status: StatusAktiv}, true, true, false},
+	}
+	var want []string
+	for _, tt := range tests {
+		u := link(tt.id)
+		if tt.rec != nil {
+			tt.rec.URL = u
+			if err := db.Observe(tt.rec, now.Add(-time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if tt.notified {
+			if err := db.AddNotification(u, "linz", "anna@example.com", now.Add(-time.Hour)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if tt.gone {
+			if err := db.MarkGone(u, now); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if tt.want {
+			want = append(want, u)
+		}
+	}
+	got, err := db.Tracked(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Tracked = %q, want %q", got, want)
+	}
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	db := openTestDB(t)
+	seen1 := time.Date(2025, 3, 1, 8, 0, 0, 0, time.UTC)
+	seen2 := time.Date(2025, 4, 1, 8, 0, 0, 0, time.UTC)
+
+	// testURL2 is already in the DB with a newer fetch.
+	fetched := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	if err := db.Observe(&EdiktRecord{URL: testURL2}, fetched); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "db.dat")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := legacyDB{
+		Edikt: map[string]bool{testURL1: true, testURL2: true, testURL3: false},
+		Seen:  map[string]time.Time{testURL1: seen1, testURL2: seen2},
+	}
+	if err := gob.NewEncoder(f).Encode(old); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	n, err := db.MigrateLegacy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("imported %d URLs, want 3", n)
+	}
+	if _, err := os.Stat(path + ".migrated"); err != nil {
+		t.Errorf("legacy file not renamed: %v", err)
+	}
+	if _, err := db.MigrateLegacy(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("second migration: %v, want a missing file", err)
+	}
+
+	e1, _ := db.Edikt(testURL1)
+	if e1 == nil || !e1.FirstSeen.Equal(seen1) || !e1.LastFetched.Equal(seen1) || e1.NotifiedAt.IsZero() {
+		t.Errorf("notified legacy edikt = %+v, want first seen and fetched %v and notified", e1, seen1)
+	}
+	e2, _ := db.Edikt(testURL2)
+	if e2 == nil || !e2.LastFetched.Equal(fetched) || !e2.NotifiedAt.IsZero() {
+		t.Errorf("existing edikt = %+v, want it unchanged", e2)
+	}
+	e3, _ := db.Edikt(testURL3)
+	if e3 == nil || !e3.LastFetched.IsZero() || !e3.NotifiedAt.IsZero() {
+		t.Errorf("unfetched legacy edikt = %+v, want never fetched or notified", e3)
+	}
+}
+
+// TestMigrations opens databases created by earlier versions of the schema.
+func TestMigrations(t *testing.T) {
+	for version := 0; version < len(migrations); version++ {
+		t.Run(fmt.Sprintf("from %d", version), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "old.db")
+			conn, err := sql.Open("sqlite", "file:"+path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, m := range migrations[:version] {
+				if _, err := conn.Exec(m); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if version > 0 {
+				if _, err := conn.Exec(`INSERT INTO edikte (url, id, first_seen, notified_at) VALUES (?, ?, ?, ?)`,
+					testURL1, ediktID(testURL1), "2025-03-01T08:00:00Z", "2025-03-01T08:00:00Z"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := conn.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version)); err != nil {
+				t.Fatal(err)
+			}
+			_ = conn.Close()
+
+			db, err := OpenDB(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			var got int
+			if err := db.sql.QueryRow(`PRAGMA user_version`).Scan(&got); err != nil || got != len(migrations) {
+				t.Fatalf("user_version = %d, %v; want %d", got, err, len(migrations))
+			}
+
+			// The columns of later versions work, and old rows are kept.
+			now := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+			if err := db.Observe(&EdiktRecord{URL: testURL1, Status: StatusAktiv}, now); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.MarkGone(testURL1, now); err != nil {
+				t.Fatal(err)
+			}
+			e, err := db.Edikt(testURL1)
+			if err != nil || e == nil || !e.GoneAt.Equal(now) {
+				t.Fatalf("Edikt = %+v, %v; want gone at %v", e, err, now)
+			}
+			if version > 0 && e.NotifiedAt.IsZero() {
+				t.Error("row of the old version lost its notification")
+			}
+		})
+	}
+}
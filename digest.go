@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// card is one accepted edikt in a mail, with the figures derived for display.
+type card struct {
+	Profile    string
+	URL        string // alldoc URL
+	Rec        *EdiktRecord
+	Km         int    // distance from the profile's home
+	PricePerM2 int    // Schätzwert per m² of the size the limits apply to, 0 without a size
+	MapURL     string // OpenStreetMap link to the geocoded PLZ/Ort, empty if not geocoded
+}
+
+// newCard returns the card of a match of profile.
+func newCard(profile Profile, m match) card {
+	c := card{Profile: profile.Name, URL: m.it.URL, Rec: m.it.Rec, Km: m.km}
+	if size := profile.size(m.it.Rec); size > 0 {
+		c.PricePerM2 = m.it.Rec.Schaetzwert / size
+	}
+	if m.it.Geocoded {
+		lat, lon := m.it.Location.Lat, m.it.Location.Lon
+		c.MapURL = fmt.Sprintf("https://www.openstreetmap.org/?mlat=%.5f&mlon=%.5f#map=13/%.5f/%.5f", lat, lon, lat, lon)
+	}
+	return c
+}
+
+// digest is the content of the mail to one recipient: the new matches of all their profiles,
+// the changes of edikte they were notified about and the failed items.
+type digest struct {
+	Cards    []card
+	Changes  []ediktChanges
+	Failures []failure
+}
+
+// digestFuncs are the helpers of the mail templates, see mailData.
+var digestFuncs = map[string]any{
+	"num":    formatNumber,
+	"date":   func(t time.Time) string { return t.Format("02.01.2006") },
+	"orDash": orDash,
+	"file":   documentName,
+}
+
+// formatNumber formats n with "." as thousands separator, e.g. 30.000.
+func formatNumber(n int) string {
+	s := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "." + s[i:]
+	}
+	return sign + s
+}
+
+// documentName returns the unescaped file name of a document link for display.
+func documentName(link string) string {
+	u, err := url.Parse(link)
+	if err != nil || strings.Trim(u.Path, "/") == "" {
+		return link
+	}
+	return path.Base(u.Path)
+}
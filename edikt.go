@@ -1,7 +1,6 @@
 package main
 
 import (
-	"ediktscraper/openstreetmap"
 	"net/url"
 	"strconv"
 	"strings"
@@ -21,8 +20,9 @@ type Edikt map[string]*goquery.Selection
 //	  <p class="col-sm-9">Value...</p>
 //	</div>
 //
-// Returns a map from cleaned label (colon removed) to the value <p>.
-func ParseEdikt(doc *goquery.Document) Edikt {
+// Returns a map from cleaned label (colon removed) to the value <p>,
+// plus the typed EdiktRecord built from it, including its Status. baseURL is the URL of the page.
+func ParseEdikt(doc *goquery.Document, baseURL *url.URL) (Edikt, *EdiktRecord) {
 	edikt := make(Edikt)
 
 	rows := doc.Find("div.row")
@@ -40,7 +40,10 @@ func ParseEdikt(doc *goquery.Document) Edikt {
 		edikt[key] = valueSect
 	})
 
-	return edikt
+	// The status needs the headings, which are not part of the field map.
+	rec := NewEdiktRecord(edikt, baseURL)
+	rec.Status = ParseStatus(doc, edikt)
+	return edikt, rec
 }
 
 //------------------------------------------------------------------------------------------------------------
@@ -65,6 +68,13 @@ func (e Edikt) GetTxt(key string) string {
 }
 
 // GetInt parses a positive integer from the field's text.
+// See parseInt for the accepted formats.
+// Returns 0 for empty strings, -1 if parsing fails.
+func (e Edikt) GetInt(key string) int {
+	return parseInt(e.GetTxt(key))
+}
+
+// parseInt parses a positive integer from free text.
 // It tolerates formats like "1.234,00 EUR" by:
 //   - splitting on space and taking the first token,
 //   - dropping the decimal part after a comma,
@@ -72,8 +82,7 @@ func (e Edikt) GetTxt(key string) string {
 //   - trimming spaces.
 //
 // Returns 0 for empty strings, -1 if parsing fails.
-func (e Edikt) GetInt(key string) int {
-	value := e.GetTxt(key)
+func parseInt(value string) int {
 
 	// Keep the first token before any space (drops units like EUR, m², etc.).
 	spl := strings.Split(value, " ")
@@ -147,55 +156,12 @@ func (e Edikt) PlzOrt() string {
 	return e.GetTxt("PLZ/Ort")
 }
 
-// Entfernung returns a distance metric derived from the "PLZ/Ort" using openstreetmap.Distance.
-// The unit and semantics depend on the openstreetmap implementation.
-func (e Edikt) Entfernung() int {
-	return openstreetmap.Distance(e.PlzOrt())
-}
-
 // Liegenschaftsadresse returns the "Liegenschaftsadresse" field as plain text.
 func (e Edikt) Liegenschaftsadresse() string {
 	return e.GetTxt("Liegenschaftsadresse")
 }
 
-// KurzgutachtenLink returns the single absolute URL from the "Kurzgutachten" field.
-// Returns an empty string if no link exists. Panics if more than one link is present.
-func (e Edikt) KurzgutachtenLink(baseURL *url.URL) string {
-	links := e.GetLinks("Kurzgutachten", baseURL)
-	if len(links) == 0 {
-		return ""
-	}
-	if len(links) != 1 {
-		panic("more than one link")
-	}
-	return links[0]
-}
-
-// Kurzgutachten fetches and returns the cleaned text of the short appraisal page.
-// Returns an empty string if no link is available. Errors from RequestPage are ignored.
-func (e Edikt) Kurzgutachten(baseURL *url.URL) string {
-	link := e.KurzgutachtenLink(baseURL)
-	if len(link) == 0 {
-		return "" // no link available
-	}
-
-	doc, _, _ := RequestPage(link) // ignoring status and error
-	txt := doc.Find("body").Text()
-	return CleanText(txt)
-}
-
 // LanggutachtenLinks returns all absolute URLs from the "Langgutachten" field.
 func (e Edikt) LanggutachtenLinks(baseURL *url.URL) []string {
 	return e.GetLinks("Langgutachten", baseURL)
 }
-
-// Langgutachten downloads all long appraisal files referenced by LanggutachtenLinks.
-// Returns a slice of file contents as byte slices. Errors from Request are ignored.
-func (e Edikt) Langgutachten(baseURL *url.URL) [][]byte {
-	files := make([][]byte, 0)
-	for _, link := range e.LanggutachtenLinks(baseURL) {
-		b := Request(link) // ignoring errors and HTTP status
-		files = append(files, b)
-	}
-	return files
-}
@@ -1,114 +1,121 @@
 package email
 
 import (
-	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net/smtp"
 	"os"
+	"strings"
 )
 
-// SendEmail sends a UTF-8 plain text email using STARTTLS when available.
-func SendEmail(to, subject, body string) {
-	host, port, user, pass, _ := LoadOrInitMailConfig()
-	from := user
+// ErrConfigCreated is returned by LoadOrInitMailConfig after writing a config file with dummy values.
+var ErrConfigCreated = errors.New("mail config file created with dummy values, please edit it")
 
-	// Build RFC 5322 message with CRLF line endings
-	msg := []byte(
-		"From: " + from + "\r\n" +
-			"To: " + to + "\r\n" +
-			"Subject: " + subject + "\r\n" +
-			"\r\n" +
-			body + "\r\n")
+// MailConfig are the SMTP settings and the default recipients.
+//
+// Security is "tls" (implicit TLS), "starttls" or "none"; if empty, it follows from the port:
+// 587 uses STARTTLS, 25 none and any other port implicit TLS.
+// Auth is "plain", "login", "cram-md5" or "none"; if empty, a mechanism offered by the server
+// is used, or none without a user. Without TLS, only "cram-md5" sends no password; "plain"
+// and "login" are then allowed for localhost only, and the empty Auth uses no other.
+// From is the sender address; if empty, User is the sender and must be an address.
+// To are the default recipients; Cc and Bcc get a copy of every mail.
+type MailConfig struct {
+	Host     string     `json:"host"`
+	Port     int        `json:"port"`
+	Security string     `json:"security,omitempty"`
+	Auth     string     `json:"auth,omitempty"`
+	User     string     `json:"user"`
+	Pass     string     `json:"pass"`
+	From     string     `json:"from,omitempty"`
+	To       Recipients `json:"to"`
+	Cc       Recipients `json:"cc,omitempty"`
+	Bcc      Recipients `json:"bcc,omitempty"`
+}
 
-	addr := fmt.Sprintf("%s:%d", host, port)
+// Recipients is a list of addresses. In JSON it is an array, or a string of
+// addresses separated by ";" as in older configs.
+type Recipients []string
 
-	// Establish TLS first because port 465 expects implicit TLS
-	tlsCfg := &tls.Config{
-		ServerName: host, // must match server certificate
-	}
-	conn, err := tls.Dial("tcp", addr, tlsCfg)
-	if err != nil {
-		panic(err) // minimal error handling for demo
+// sender returns the sender address, see MailConfig.
+func (cfg *MailConfig) sender() string {
+	if cfg.From != "" {
+		return cfg.From
 	}
-	defer conn.Close()
+	return cfg.User
+}
 
-	// Create SMTP client on the TLS connection
-	c, err := smtp.NewClient(conn, host)
-	if err != nil {
-		panic(err)
+// UnmarshalJSON accepts ["a@example.com", "b@example.com"] and "a@example.com;b@example.com".
+func (r *Recipients) UnmarshalJSON(data []byte) error {
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		var s string
+		if json.Unmarshal(data, &s) != nil {
+			return errors.New("recipients: want a list of addresses or a string separated by \";\"")
+		}
+		list = strings.Split(s, ";")
 	}
-	defer c.Close()
 
-	// Authenticate using PLAIN
-	auth := smtp.PlainAuth("", user, pass, host)
-	if err = c.Auth(auth); err != nil {
-		panic(err)
+	// Drop the blanks of "a;b;" and " a ; b"
+	*r = nil
+	for _, addr := range list {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			*r = append(*r, addr)
+		}
 	}
+	return nil
+}
 
-	// Set envelope and send data
-	if err = c.Mail(from); err != nil {
-		panic(err)
-	}
-	if err = c.Rcpt(to); err != nil {
-		panic(err)
-	}
-	w, err := c.Data()
-	if err != nil {
-		panic(err)
-	}
-	if _, err = w.Write(msg); err != nil {
-		panic(err)
-	}
-	if err = w.Close(); err != nil {
-		panic(err)
-	}
+// configPath is the mail config file, see SetConfigPath.
+var configPath = "mail.conf"
 
-	// Politely terminate the SMTP session
-	if err = c.Quit(); err != nil {
-		panic(err)
-	}
+// SetConfigPath sets the file read by LoadMailConfig and LoadOrInitMailConfig. The default is "mail.conf".
+func SetConfigPath(path string) {
+	configPath = path
 }
 
-// ------------------------------------------------------------------------------------------------------------------ //
+// LoadOrInitMailConfig reads the mail config file, see SetConfigPath.
+// If it does not exist, it writes dummy values and returns an error wrapping ErrConfigCreated to force editing.
+func LoadOrInitMailConfig() (*MailConfig, error) {
+	cfg, err := LoadMailConfig()
+	if !errors.Is(err, os.ErrNotExist) {
+		return cfg, err
+	}
 
-type MailConfig struct {
-	Host string `json:"host"`
-	Port int    `json:"port"`
-	User string `json:"user"`
-	Pass string `json:"pass"`
-	To   string `json:"to"`
+	// Create with dummy values
+	path := configPath
+	dummy := MailConfig{
+		Host:     "smtp.example.com",
+		Port:     465,
+		Security: SecurityTLS,
+		User:     "user@example.com",
+		Pass:     "change-me",
+		To:       Recipients{"to@example.com"},
+	}
+	b, _ := json.MarshalIndent(dummy, "", "  ")
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%s: %w", path, ErrConfigCreated)
 }
 
-// LoadOrInitMailConfig reads mail.json.
-// If it does not exist, it writes dummy values and returns an error to force editing.
-func LoadOrInitMailConfig() (host string, port int, user, pass, to string) {
-	path := "mail.conf"
-
-	// Try to read existing config
+// LoadMailConfig reads and validates the mail config file, see SetConfigPath.
+// Unlike LoadOrInitMailConfig it never writes; a missing file is an error wrapping os.ErrNotExist.
+func LoadMailConfig() (*MailConfig, error) {
+	path := configPath
 	data, err := os.ReadFile(path)
 	if err != nil {
-		if os.IsNotExist(err) {
-			// Create with dummy values
-			dummy := MailConfig{
-				Host: "smtp.example.com",
-				Port: 465,
-				User: "user@example.com",
-				Pass: "change-me",
-				To:   "to@example.com",
-			}
-			b, _ := json.MarshalIndent(dummy, "", "  ")
-			_ = os.WriteFile(path, b, 0o600)
-			panic("edit mail config file")
-		}
-		panic(err)
+		return nil, err
 	}
 
 	// Decode JSON
 	var cfg MailConfig
 	if err := json.Unmarshal(data, &cfg); err != nil {
-		panic(err)
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
 	}
 
-	return cfg.Host, cfg.Port, cfg.User, cfg.Pass, cfg.To
+	return &cfg, nil
 }
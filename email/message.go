@@ -0,0 +1,180 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email in UTF-8, optionally with an HTML alternative.
+// Bytes renders it as an RFC 5322 message with RFC 2045 MIME headers.
+type Message struct {
+	From    string    // address, optionally with display name: "Edikte <user@example.com>"
+	To      []string  // addresses like From
+	Cc      []string  // addresses like From, shown to all recipients
+	Bcc     []string  // addresses like From, in the envelope only
+	Subject string    // any UTF-8 text, encoded per RFC 2047 if needed
+	Body    string    // plain text with "\n" line endings
+	HTML    string    // HTML version of Body; if set, the message is multipart/alternative
+	Date    time.Time // zero means now
+}
+
+// Bytes renders the message with CRLF line endings.
+// Addresses are validated; Bcc is left out of the headers. Display names and the subject are encoded as RFC 2047 "encoded words"
+// if they are not plain ASCII. The bodies are sent as quoted-printable, so lines of any
+// length and umlauts survive 7-bit relays. With HTML, the text part comes first, so clients
+// that cannot show HTML fall back to it.
+func (m *Message) Bytes() ([]byte, error) {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return nil, fmt.Errorf("from %q: %w", m.From, err)
+	}
+	to, err := parseAddresses("to", m.To)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := parseAddresses("cc", m.Cc)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseAddresses("bcc", m.Bcc); err != nil {
+		return nil, err
+	}
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	var b bytes.Buffer
+	header := func(name, value string) {
+		b.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", from.String())
+	header("To", joinAddresses(to))
+	if len(cc) > 0 {
+		header("Cc", joinAddresses(cc))
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", m.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", messageID(from.Address))
+	header("MIME-Version", "1.0")
+
+	// Plain text only.
+	if m.HTML == "" {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		b.WriteString("\r\n")
+		if err := writeQP(&b, m.Body); err != nil {
+			return nil, err
+		}
+		b.WriteString("\r\n")
+		return b.Bytes(), nil
+	}
+
+	// Text and HTML as alternatives, in increasing order of preference.
+	mw := multipart.NewWriter(&b)
+	header("Content-Type", mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": mw.Boundary()}))
+	b.WriteString("\r\n")
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", m.Body},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQP(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Recipients returns the bare addresses of To, Cc and Bcc for the envelope, each once.
+func (m *Message) Recipients() ([]string, error) {
+	var rcpts []string
+	seen := make(map[string]bool)
+	for _, field := range []struct {
+		name  string
+		addrs []string
+	}{{"to", m.To}, {"cc", m.Cc}, {"bcc", m.Bcc}} {
+		list, err := parseAddresses(field.name, field.addrs)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range list {
+			if !seen[strings.ToLower(a.Address)] {
+				seen[strings.ToLower(a.Address)] = true
+				rcpts = append(rcpts, a.Address)
+			}
+		}
+	}
+	return rcpts, nil
+}
+
+// sender returns the bare address of From for the envelope.
+func (m *Message) sender() (string, error) {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return "", fmt.Errorf("from %q: %w", m.From, err)
+	}
+	return from.Address, nil
+}
+
+// parseAddresses validates the addresses of the header field name.
+func parseAddresses(name string, addrs []string) ([]*mail.Address, error) {
+	list := make([]*mail.Address, 0, len(addrs))
+	for _, addr := range addrs {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			return nil, fmt.Errorf("%s %q: %w", name, addr, err)
+		}
+		list = append(list, a)
+	}
+	return list, nil
+}
+
+// joinAddresses formats addresses for a header, encoding display names if needed.
+func joinAddresses(addrs []*mail.Address) string {
+	s := make([]string, len(addrs))
+	for i, a := range addrs {
+		s[i] = a.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// writeQP writes body to w as quoted-printable.
+// The writer turns "\n" into CRLF and wraps long lines with soft breaks.
+func writeQP(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// messageID returns a new, globally unique Message-ID in the domain of the sender address.
+func messageID(from string) string {
+	domain := "localhost"
+	if i := strings.LastIndexByte(from, '@'); i >= 0 && i < len(from)-1 {
+		domain = from[i+1:]
+	}
+	random := make([]byte, 12)
+	_, _ = rand.Read(random) // never fails, see crypto/rand.Read
+	return fmt.Sprintf("<%d.%s@%s>", time.Now().UnixNano(), hex.EncodeToString(random), domain)
+}
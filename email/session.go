@@ -0,0 +1,109 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"time"
+)
+
+// Session is one SMTP connection that sends any number of messages, see Dial.
+type Session struct {
+	c    *smtp.Client
+	conn net.Conn // for deadlines
+	from string
+}
+
+// RecipientResult is the delivery status of one envelope recipient.
+// Err is the server's rejection of the address, or the error of the transfer
+// if the address was accepted but the message was not.
+type RecipientResult struct {
+	Addr string
+	Err  error
+}
+
+// Dial opens a session with the server of cfg, see MailConfig. The sender is cfg.From, or cfg.User.
+func Dial(cfg *MailConfig) (*Session, error) {
+	c, conn, err := dial(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{c: c, conn: conn, from: cfg.sender()}, nil
+}
+
+// Send sends m to all its To, Cc and Bcc addresses in one transfer; an empty m.From
+// is the sender of the session. Addresses the server rejects do not stop the others.
+// It returns the status of each address and an error if no address got the message.
+func (s *Session) Send(m *Message) ([]RecipientResult, error) {
+	if m.From == "" {
+		m.From = s.from
+	}
+	msg, err := m.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("build mail: %w", err)
+	}
+	rcpts, err := m.Recipients()
+	if err != nil {
+		return nil, fmt.Errorf("build mail: %w", err)
+	}
+	sender, err := m.sender()
+	if err != nil {
+		return nil, fmt.Errorf("build mail: %w", err)
+	}
+
+	// Set envelope; collect rejected recipients instead of giving up
+	_ = s.conn.SetDeadline(time.Now().Add(sendTimeout))
+	if err := s.c.Mail(sender); err != nil {
+		return nil, fmt.Errorf("smtp MAIL FROM: %w", err)
+	}
+	results := make([]RecipientResult, len(rcpts))
+	var accepted []int
+	for i, addr := range rcpts {
+		results[i].Addr = addr
+		if err := s.c.Rcpt(addr); err != nil {
+			results[i].Err = fmt.Errorf("smtp RCPT TO %s: %w", addr, err)
+			continue
+		}
+		accepted = append(accepted, i)
+	}
+	if len(accepted) == 0 {
+		_ = s.c.Reset() // abort the transaction, so the session can send the next message
+		return results, errors.New("smtp: all recipients rejected")
+	}
+
+	// Send data; a failure here affects every accepted recipient
+	if err := s.data(msg); err != nil {
+		_ = s.c.Reset()
+		for _, i := range accepted {
+			results[i].Err = err
+		}
+		return results, err
+	}
+	return results, nil
+}
+
+// data transfers msg after the envelope was set.
+func (s *Session) data(msg []byte) error {
+	w, err := s.c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if _, err = w.Write(msg); err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("smtp DATA: %w", err)
+	}
+	return nil
+}
+
+// Close politely terminates the session.
+func (s *Session) Close() error {
+	_ = s.conn.SetDeadline(time.Now().Add(dialTimeout))
+	if err := s.c.Quit(); err != nil {
+		_ = s.c.Close()
+		return fmt.Errorf("smtp QUIT: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package email
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSessionSend(t *testing.T) {
+	s := newFakeServer(t, true, "AUTH PLAIN")
+	s.reject = "gone@"
+	session, err := Dial(s.config(SecurityTLS, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A rejected address does not stop the others.
+	results, err := session.Send(&Message{
+		To:      []string{"Anna <anna@example.com>", "gone@example.com"},
+		Bcc:     []string{"archiv@example.com"},
+		Subject: "Neue Edikte",
+		Body:    "Hallo",
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	want := map[string]bool{"anna@example.com": true, "gone@example.com": false, "archiv@example.com": true}
+	if len(results) != len(want) {
+		t.Fatalf("results = %+v, want %d", results, len(want))
+	}
+	for _, r := range results {
+		if ok, found := want[r.Addr]; !found || ok != (r.Err == nil) {
+			t.Errorf("result %s: %v", r.Addr, r.Err)
+		}
+	}
+
+	// The session sends the next message, even if all its addresses are rejected.
+	if _, err := session.Send(&Message{To: []string{"gone@example.com"}, Subject: "x", Body: "x"}); err == nil {
+		t.Error("Send to rejected address succeeded")
+	}
+	if _, err := session.Send(&Message{To: []string{"bernd@example.com"}, Subject: "x", Body: "x"}); err != nil {
+		t.Errorf("Send after rejection: %v", err)
+	}
+	if err := session.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if got := strings.Join(s.rcpts, ","); got != "anna@example.com,archiv@example.com,bernd@example.com" {
+		t.Errorf("accepted recipients = %s", got)
+	}
+	if len(s.messages) != 2 {
+		t.Fatalf("got %d messages, want 2", len(s.messages))
+	}
+	if m := s.messages[0]; strings.Contains(m, "archiv@") || !strings.Contains(m, "From: <"+testUser+">") {
+		t.Errorf("first message has a Bcc header or no sender:\n%s", m)
+	}
+}
+
+// TestSessionSendRelay sends through a relay without a user, from the configured sender.
+func TestSessionSendRelay(t *testing.T) {
+	s := newFakeServer(t, false, "8BITMIME")
+	cfg := s.config(SecurityNone, AuthNone)
+	cfg.User, cfg.Pass, cfg.From = "", "", "Edikte <edikte@example.com>"
+	session, err := Dial(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := session.Send(&Message{To: []string{"anna@example.com"}, Subject: "x", Body: "x"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := session.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.auth != "" {
+		t.Errorf("auth = %q, want none", s.auth)
+	}
+	if s.from != "edikte@example.com" {
+		t.Errorf("envelope sender = %q, want edikte@example.com", s.from)
+	}
+	if len(s.messages) != 1 || !strings.Contains(s.messages[0], `From: "Edikte" <edikte@example.com>`) {
+		t.Errorf("messages = %q, want one from edikte@example.com", s.messages)
+	}
+}
@@ -0,0 +1,234 @@
+package email
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Security modes of MailConfig.Security.
+const (
+	SecurityTLS      = "tls"      // implicit TLS from the first byte, usually port 465
+	SecuritySTARTTLS = "starttls" // plain connection upgraded with STARTTLS, usually port 587
+	SecurityNone     = "none"     // no encryption, e.g. an internal relay on port 25
+)
+
+// Auth mechanisms of MailConfig.Auth.
+const (
+	AuthPlain   = "plain"
+	AuthLogin   = "login"
+	AuthCRAMMD5 = "cram-md5"
+	AuthNone    = "none"
+)
+
+// Timeouts of a session; tests shorten them. A server that stops answering, e.g. a TLS
+// port spoken to in plain text, would block forever otherwise.
+var (
+	dialTimeout = 30 * time.Second // connecting, securing and authenticating
+	sendTimeout = 2 * time.Minute  // sending one message
+)
+
+// rootCAs verifies the server certificates; nil uses the system roots. Tests set it.
+var rootCAs *x509.CertPool
+
+// security returns the security mode, inferred from the port if none is set:
+// 587 uses STARTTLS, 25 none and everything else implicit TLS like before.
+func (cfg *MailConfig) security() string {
+	if cfg.Security != "" {
+		return strings.ToLower(cfg.Security)
+	}
+	switch cfg.Port {
+	case 587:
+		return SecuritySTARTTLS
+	case 25:
+		return SecurityNone
+	default:
+		return SecurityTLS
+	}
+}
+
+// validate checks the security mode, the auth mechanism, the sender and the addresses.
+func (cfg *MailConfig) validate() error {
+	if _, err := (&Message{To: cfg.To, Cc: cfg.Cc, Bcc: cfg.Bcc}).Recipients(); err != nil {
+		return err
+	}
+	if s := cfg.security(); s != SecurityTLS && s != SecuritySTARTTLS && s != SecurityNone {
+		return fmt.Errorf("security %q: must be %q, %q or %q", cfg.Security, SecurityTLS, SecuritySTARTTLS, SecurityNone)
+	}
+	switch mech := strings.ToLower(cfg.Auth); mech {
+	case "", AuthNone:
+	case AuthPlain, AuthLogin, AuthCRAMMD5:
+		if cfg.User == "" {
+			return fmt.Errorf("auth %q: missing user", cfg.Auth)
+		}
+		if cfg.security() == SecurityNone && mech != AuthCRAMMD5 && !isLocalhost(cfg.Host) {
+			return fmt.Errorf("auth %q would send the password unencrypted with security %q; "+
+				"use security %q or %q, auth %q, or auth %q for a relay", cfg.Auth, SecurityNone,
+				SecuritySTARTTLS, SecurityTLS, AuthCRAMMD5, AuthNone)
+		}
+	default:
+		return fmt.Errorf("auth %q: must be %q, %q, %q, %q or empty", cfg.Auth, AuthPlain, AuthLogin, AuthCRAMMD5, AuthNone)
+	}
+
+	// Every mail needs a sender; a relay without a user needs an explicit one.
+	if cfg.sender() == "" {
+		return errors.New(`missing sender: set "from", or a "user" that is an email address`)
+	}
+	if _, err := (&Message{From: cfg.sender()}).sender(); err != nil {
+		return fmt.Errorf(`sender: %w; set "from" if the user is no email address`, err)
+	}
+	return nil
+}
+
+// dial connects to the SMTP server, secures the connection as configured and authenticates.
+// The mechanisms offered in the EHLO response decide about STARTTLS and, without a configured
+// mechanism, about the auth mechanism. It also returns the network connection for deadlines.
+func dial(cfg *MailConfig) (*smtp.Client, net.Conn, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, nil, err
+	}
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	tlsCfg := &tls.Config{
+		ServerName: cfg.Host, // must match server certificate
+		RootCAs:    rootCAs,
+	}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+
+	// Implicit TLS encrypts before the greeting, the other modes start in plain text
+	var conn net.Conn
+	var err error
+	if cfg.security() == SecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsCfg)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("smtp dial %s: %w", addr, err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(dialTimeout))
+
+	// Create SMTP client; it knows about implicit TLS from the connection type
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("smtp hello: %w", err)
+	}
+
+	// Upgrade the connection; never fall back to plain text if the server does not offer it
+	if cfg.security() == SecuritySTARTTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			_ = c.Close()
+			return nil, nil, errors.New("smtp STARTTLS: not offered by server")
+		}
+		if err := c.StartTLS(tlsCfg); err != nil {
+			_ = c.Close()
+			return nil, nil, fmt.Errorf("smtp STARTTLS: %w", err)
+		}
+	}
+
+	// Authenticate
+	auth, err := cfg.auth(c)
+	if err != nil {
+		_ = c.Close()
+		return nil, nil, fmt.Errorf("smtp auth: %w", err)
+	}
+	if auth != nil {
+		if err := c.Auth(auth); err != nil {
+			_ = c.Close()
+			return nil, nil, fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	return c, conn, nil
+}
+
+// auth returns the auth mechanism for c, or nil to send without authentication.
+// Without a configured mechanism, it picks one the server offers: PLAIN, LOGIN or CRAM-MD5
+// on an encrypted connection, only CRAM-MD5 otherwise, since it does not reveal the password.
+// No user, no AUTH in the EHLO response or no usable mechanism means no authentication,
+// as for an internal relay; a server that needs it rejects the sender then.
+func (cfg *MailConfig) auth(c *smtp.Client) (smtp.Auth, error) {
+	mech := strings.ToLower(cfg.Auth)
+	if mech == AuthNone || (mech == "" && cfg.User == "") {
+		return nil, nil
+	}
+
+	ok, params := c.Extension("AUTH")
+	offered := strings.Fields(strings.ToLower(params))
+	if mech == "" {
+		if !ok {
+			return nil, nil
+		}
+		prefer := []string{AuthPlain, AuthLogin, AuthCRAMMD5}
+		if _, encrypted := c.TLSConnectionState(); !encrypted {
+			prefer = []string{AuthCRAMMD5}
+		}
+		for _, m := range prefer {
+			if slices.Contains(offered, m) {
+				mech = m
+				break
+			}
+		}
+		if mech == "" {
+			return nil, nil
+		}
+	} else if !slices.Contains(offered, mech) {
+		return nil, fmt.Errorf("%s not offered by server: %q", strings.ToUpper(mech), params)
+	}
+
+	switch mech {
+	case AuthPlain:
+		return smtp.PlainAuth("", cfg.User, cfg.Pass, cfg.Host), nil
+	case AuthLogin:
+		return &loginAuth{user: cfg.User, pass: cfg.Pass, host: cfg.Host}, nil
+	default:
+		return smtp.CRAMMD5Auth(cfg.User, cfg.Pass), nil
+	}
+}
+
+// loginAuth implements the AUTH LOGIN mechanism, which net/smtp lacks.
+// Like smtp.PlainAuth, it only sends the password over TLS or to localhost.
+type loginAuth struct {
+	user, pass, host string
+	step             int // challenges answered
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	a.step = 0
+	return "LOGIN", nil, nil
+}
+
+// Next answers the "Username:" and "Password:" challenges in this order,
+// whatever their wording, since servers differ there.
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	a.step++
+	switch a.step {
+	case 1:
+		return []byte(a.user), nil
+	case 2:
+		return []byte(a.pass), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN challenge %q", fromServer)
+	}
+}
+
+// isLocalhost reports whether host is the local machine, where unencrypted
+// passwords are acceptable like in smtp.PlainAuth.
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
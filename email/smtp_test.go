@@ -0,0 +1,373 @@
+package email
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Credentials accepted by the fake server.
+const (
+	testUser = "user@example.com"
+	testPass = "secret"
+)
+
+// fakeServer is an in-process SMTP server for the tests. It speaks just enough SMTP
+// for net/smtp: EHLO, STARTTLS, AUTH PLAIN/LOGIN/CRAM-MD5, MAIL, RCPT, DATA, RSET and QUIT.
+type fakeServer struct {
+	ln       net.Listener
+	cert     tls.Certificate
+	implicit bool     // TLS from the first byte
+	ext      []string // EHLO extensions, e.g. "STARTTLS" or "AUTH PLAIN LOGIN"
+	reject   string   // RCPT TO addresses containing it are rejected
+
+	mu       sync.Mutex
+	auth     string   // mechanism of the last successful AUTH
+	tls      bool     // whether the last command came over TLS
+	from     string   // envelope sender of the last MAIL FROM
+	rcpts    []string // accepted recipients
+	messages []string // received DATA
+}
+
+// newFakeServer starts a server on a local port that serves one connection at a time.
+func newFakeServer(t *testing.T, implicit bool, ext ...string) *fakeServer {
+	t.Helper()
+	s := &fakeServer{implicit: implicit, ext: ext, cert: testCertificate(t)}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if implicit {
+		ln = tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{s.cert}})
+	}
+	s.ln = ln
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// config returns a mail config for the server.
+func (s *fakeServer) config(security, auth string) *MailConfig {
+	return &MailConfig{
+		Host:     "127.0.0.1",
+		Port:     s.ln.Addr().(*net.TCPAddr).Port,
+		Security: security,
+		Auth:     auth,
+		User:     testUser,
+		Pass:     testPass,
+	}
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	r := bufio.NewReader(conn)
+	reply := func(lines ...string) {
+		for i, l := range lines {
+			sep := "-"
+			if i == len(lines)-1 {
+				sep = " "
+			}
+			_, _ = conn.Write([]byte(l[:3] + sep + strings.TrimSpace(l[3:]) + "\r\n"))
+		}
+	}
+	readLine := func() (string, bool) {
+		line, err := r.ReadString('\n')
+		return strings.TrimRight(line, "\r\n"), err == nil
+	}
+	_, encrypted := conn.(*tls.Conn)
+
+	reply("220 fake ESMTP")
+	for {
+		line, ok := readLine()
+		if !ok {
+			return
+		}
+		s.mu.Lock()
+		s.tls = encrypted
+		s.mu.Unlock()
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			lines := []string{"250fake"}
+			for _, e := range s.ext {
+				if e == "STARTTLS" && encrypted {
+					continue
+				}
+				lines = append(lines, "250"+e)
+			}
+			reply(lines...)
+
+		case cmd == "STARTTLS":
+			reply("220 go ahead")
+			tc := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{s.cert}})
+			if err := tc.Handshake(); err != nil {
+				return
+			}
+			conn, r, encrypted = tc, bufio.NewReader(tc), true
+
+		case strings.HasPrefix(cmd, "AUTH "):
+			fields := strings.Fields(line)
+			mech := strings.ToUpper(fields[1])
+			var user, pass string
+			switch mech {
+			case "PLAIN":
+				b, _ := base64.StdEncoding.DecodeString(fields[2])
+				if parts := strings.Split(string(b), "\x00"); len(parts) == 3 {
+					user, pass = parts[1], parts[2]
+				}
+			case "LOGIN":
+				reply("334 " + base64.StdEncoding.EncodeToString([]byte("Username:")))
+				l, _ := readLine()
+				b, _ := base64.StdEncoding.DecodeString(l)
+				user = string(b)
+				reply("334 " + base64.StdEncoding.EncodeToString([]byte("Password:")))
+				l, _ = readLine()
+				b, _ = base64.StdEncoding.DecodeString(l)
+				pass = string(b)
+			case "CRAM-MD5":
+				challenge := "<1234.5678@fake>"
+				reply("334 " + base64.StdEncoding.EncodeToString([]byte(challenge)))
+				l, _ := readLine()
+				b, _ := base64.StdEncoding.DecodeString(l)
+				name, digest, _ := strings.Cut(string(b), " ")
+				mac := hmac.New(md5.New, []byte(testPass))
+				mac.Write([]byte(challenge))
+				if digest == hex.EncodeToString(mac.Sum(nil)) {
+					user, pass = name, testPass
+				}
+			}
+			if user != testUser || pass != testPass {
+				reply("535 authentication failed")
+				continue
+			}
+			s.mu.Lock()
+			s.auth = mech
+			s.mu.Unlock()
+			reply("235 authenticated")
+
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			s.mu.Lock()
+			s.from, _, _ = strings.Cut(strings.TrimPrefix(line[len("MAIL FROM:"):], "<"), ">")
+			s.mu.Unlock()
+			reply("250 ok")
+
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			if s.reject != "" && strings.Contains(line, s.reject) {
+				reply("550 no such user")
+				continue
+			}
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			s.mu.Unlock()
+			reply("250 ok")
+
+		case cmd == "DATA":
+			reply("354 end with .")
+			var b strings.Builder
+			for {
+				l, ok := readLine()
+				if !ok || l == "." {
+					break
+				}
+				b.WriteString(l + "\n")
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, b.String())
+			s.mu.Unlock()
+			reply("250 queued")
+
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+
+		default: // RSET, NOOP
+			reply("250 ok")
+		}
+	}
+}
+
+// testCertificate returns a self-signed certificate for 127.0.0.1 and trusts it in dial.
+func testCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "fake smtp"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	prev := rootCAs
+	rootCAs = pool
+	t.Cleanup(func() { rootCAs = prev })
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestDial(t *testing.T) {
+	prev := dialTimeout
+	dialTimeout = 500 * time.Millisecond
+	defer func() { dialTimeout = prev }()
+
+	tests := []struct {
+		name     string
+		implicit bool     // server expects implicit TLS
+		ext      []string // server extensions
+		security string
+		auth     string
+		noUser   bool
+		wantAuth string // mechanism used, "" for none
+		wantTLS  bool
+		wantErr  string
+	}{
+		{name: "implicit TLS, auto picks PLAIN", implicit: true, ext: []string{"AUTH LOGIN PLAIN CRAM-MD5"},
+			security: SecurityTLS, wantAuth: "PLAIN", wantTLS: true},
+		{name: "implicit TLS, LOGIN only", implicit: true, ext: []string{"AUTH LOGIN"},
+			security: SecurityTLS, wantAuth: "LOGIN", wantTLS: true},
+		{name: "implicit TLS, explicit CRAM-MD5", implicit: true, ext: []string{"AUTH PLAIN CRAM-MD5"},
+			security: SecurityTLS, auth: AuthCRAMMD5, wantAuth: "CRAM-MD5", wantTLS: true},
+		{name: "implicit TLS, explicit LOGIN", implicit: true, ext: []string{"AUTH PLAIN LOGIN"},
+			security: SecurityTLS, auth: AuthLogin, wantAuth: "LOGIN", wantTLS: true},
+		{name: "implicit TLS, explicit mechanism not offered", implicit: true, ext: []string{"AUTH LOGIN"},
+			security: SecurityTLS, auth: AuthPlain, wantErr: "PLAIN not offered"},
+		{name: "STARTTLS, auto", ext: []string{"STARTTLS", "AUTH PLAIN LOGIN"},
+			security: SecuritySTARTTLS, wantAuth: "PLAIN", wantTLS: true},
+		{name: "STARTTLS, CRAM-MD5 only", ext: []string{"STARTTLS", "AUTH CRAM-MD5"},
+			security: SecuritySTARTTLS, wantAuth: "CRAM-MD5", wantTLS: true},
+		{name: "STARTTLS not offered", ext: []string{"AUTH PLAIN"},
+			security: SecuritySTARTTLS, wantErr: "STARTTLS: not offered"},
+		{name: "relay without auth", ext: []string{"8BITMIME"},
+			security: SecurityNone, noUser: true},
+		{name: "relay with user, no AUTH offered", ext: []string{"8BITMIME"},
+			security: SecurityNone},
+		{name: "none, auto skips PLAIN and LOGIN", ext: []string{"AUTH PLAIN LOGIN"},
+			security: SecurityNone},
+		{name: "none, auto picks CRAM-MD5", ext: []string{"AUTH PLAIN LOGIN CRAM-MD5"},
+			security: SecurityNone, wantAuth: "CRAM-MD5"},
+		{name: "none, explicit auth none", ext: []string{"AUTH CRAM-MD5"},
+			security: SecurityNone, auth: AuthNone},
+		{name: "plain connection to TLS port times out", implicit: true, ext: []string{"AUTH PLAIN"},
+			security: SecurityNone, noUser: true, wantErr: "timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newFakeServer(t, tt.implicit, tt.ext...)
+			cfg := s.config(tt.security, tt.auth)
+			if tt.noUser {
+				cfg.User, cfg.Pass, cfg.From = "", "", "relay@example.com"
+			}
+			session, err := Dial(cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("dial error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+
+			// Every connection must be able to deliver, not just to log in.
+			if _, err := session.Send(&Message{To: []string{"anna@example.com"}, Subject: "Test", Body: "Hallo"}); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			if err := session.Close(); err != nil {
+				t.Fatalf("QUIT: %v", err)
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if len(s.messages) != 1 || s.from != cfg.sender() {
+				t.Errorf("got %d messages from %q, want 1 from %q", len(s.messages), s.from, cfg.sender())
+			}
+			if s.auth != tt.wantAuth {
+				t.Errorf("auth = %q, want %q", s.auth, tt.wantAuth)
+			}
+			if s.tls != tt.wantTLS {
+				t.Errorf("TLS = %v, want %v", s.tls, tt.wantTLS)
+			}
+		})
+	}
+}
+
+func TestDialWrongPassword(t *testing.T) {
+	s := newFakeServer(t, true, "AUTH PLAIN")
+	cfg := s.config(SecurityTLS, "")
+	cfg.Pass = "wrong"
+	if _, _, err := dial(cfg); err == nil || !strings.Contains(err.Error(), "smtp auth") {
+		t.Errorf("dial error = %v, want an auth error", err)
+	}
+}
+
+func TestSecurityFromPort(t *testing.T) {
+	for port, want := range map[int]string{465: SecurityTLS, 587: SecuritySTARTTLS, 25: SecurityNone, 2525: SecurityTLS} {
+		if got := (&MailConfig{Port: port}).security(); got != want {
+			t.Errorf("security for port %d = %q, want %q", port, got, want)
+		}
+	}
+	if got := (&MailConfig{Port: 587, Security: "TLS"}).security(); got != SecurityTLS {
+		t.Errorf("explicit security = %q, want %q", got, SecurityTLS)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		cfg     MailConfig
+		wantErr string
+	}{
+		{MailConfig{Host: "smtp.example.com", Port: 465, User: testUser}, ""},
+		{MailConfig{Host: "smtp.example.com", Port: 25, Auth: AuthCRAMMD5, User: testUser}, ""},
+		{MailConfig{Host: "localhost", Port: 25, Auth: AuthPlain, User: testUser}, ""},
+		{MailConfig{Host: "smtp.example.com", Port: 25, Auth: AuthPlain, User: testUser}, `auth "none" for a relay`},
+		{MailConfig{Host: "smtp.example.com", Port: 25, Security: SecurityNone, Auth: "LOGIN", User: testUser}, "unencrypted"},
+		{MailConfig{Host: "smtp.example.com", Port: 465, Security: "ssl"}, `security "ssl"`},
+		{MailConfig{Host: "smtp.example.com", Port: 465, Auth: "xoauth2"}, `auth "xoauth2"`},
+		{MailConfig{Host: "smtp.example.com", Port: 465, Auth: AuthPlain}, "missing user"},
+		{MailConfig{Host: "relay.example.com", Port: 25, Auth: AuthNone}, "missing sender"},
+		{MailConfig{Host: "relay.example.com", Port: 25, Auth: AuthNone, From: "edikte@example.com"}, ""},
+		{MailConfig{Host: "smtp.example.com", Port: 465, User: "login-name"}, `set "from"`},
+		{MailConfig{Host: "smtp.example.com", Port: 465, User: "login-name", From: "Edikte <edikte@example.com>"}, ""},
+	}
+	for _, tt := range tests {
+		err := tt.cfg.validate()
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("validate(%+v) = %v, want %q", tt.cfg, err, tt.wantErr)
+		}
+	}
+}
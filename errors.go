@@ -0,0 +1,39 @@
+package main
+
+import "fmt"
+
+// HTTPStatusError is returned by Request if the server answers with a non-2xx status.
+type HTTPStatusError struct {
+	URL        string // requested URL
+	StatusCode int    // e.g. 503
+	Status     string // e.g. "503 Service Unavailable"
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("GET %s: %s", e.URL, e.Status)
+}
+
+// ParseError is returned if a downloaded page cannot be parsed.
+type ParseError struct {
+	URL string // URL of the page
+	Err error  // underlying error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("parse %s: %v", e.URL, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// DocumentTooLargeError is returned by the archive if a document exceeds the configured maximum size,
+// and by Request if a response exceeds maxResponseBytes.
+type DocumentTooLargeError struct {
+	URL   string // document URL
+	Limit int64  // maximum size in bytes
+}
+
+func (e *DocumentTooLargeError) Error() string {
+	return fmt.Sprintf("GET %s: document larger than %d bytes", e.URL, e.Limit)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"ediktscraper/email"
+	"ediktscraper/openstreetmap"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// explain fetches and parses the edikt at link like a run does and prints every extracted
+// field, each profile's checks with their outcome, what the DB knows about the edikt and
+// which recipients of an accepting profile would get it.
+// Unlike filterItems it does not stop at the first failed check. Nothing is sent and the DB
+// is only read; the caller sets a read-only geocode store. Pages are fetched through the
+// HTTP cache like in a run, so they may be stored there.
+func explain(ctx context.Context, w io.Writer, cfg *Config, db *DB, link string) error {
+
+	// Fetch and enrich the edikt like the detail and enrich stages.
+	doc, _, base, err := RequestPage(ctx, link)
+	if err != nil {
+		return err
+	}
+	_, rec := ParseEdikt(doc, base)
+	rec.URL = link
+	kgErr := FetchKurzgutachten(ctx, rec)
+	loc, geoErr := openstreetmap.Geocode(ctx, rec.PlzOrt)
+
+	// Typed fields of the record.
+	fmt.Fprintln(w, "Edikt", link)
+	field := func(label string, value any) {
+		fmt.Fprintf(w, "  %-22s %v\n", label+":", value)
+	}
+	field("ID", rec.ID())
+	field("Dienststelle", rec.Dienststelle)
+	field("Aktenzeichen", rec.Aktenzeichen)
+	field("Kategorie", fmt.Sprintf("%s (%s)", rec.Kategorie, orDash(string(findCategory(rec.Kategorie)))))
+	field("Status", rec.Status)
+	field("Versteigerungstermin", explainTime(rec.Versteigerungstermin, "02.01.2006 15:04"))
+	field("Schätzwert", fmt.Sprintf("%d EUR", rec.Schaetzwert))
+	field("Geringstes Gebot", fmt.Sprintf("%d EUR", rec.GeringstesGebot))
+	field("Vadium", fmt.Sprintf("%d EUR", rec.Vadium))
+	field("Objektgröße", fmt.Sprintf("%d m²", rec.Objektgroesse))
+	field("Grundstücksgröße", fmt.Sprintf("%d m²", rec.Grundstuecksgroesse))
+	field("PLZ/Ort", rec.PlzOrt)
+	field("Adresse", rec.Liegenschaftsadresse)
+	field("Grundbuch", rec.Grundbuch)
+	field("EZ", rec.EZ)
+	field("Grundstücksnr.", rec.Grundstuecksnr)
+	field("Stichtag", explainTime(rec.Stichtag, "02.01.2006"))
+	field("Zubehörwert", fmt.Sprintf("%d EUR", rec.Zubehoerwert))
+	field("Kurzgutachten", rec.KurzgutachtenLink)
+	for _, l := range rec.LanggutachtenLinks {
+		field("Langgutachten", l)
+	}
+	if geoErr != nil {
+		field("Ort", fmt.Sprintf("geocode %q failed: %v", rec.PlzOrt, geoErr))
+	} else {
+		field("Ort", fmt.Sprintf("%.5f, %.5f", loc.Lat, loc.Lon))
+	}
+
+	// Raw fields of the page and the Kurzgutachten.
+	fmt.Fprintln(w, "\nPage fields:")
+	for _, label := range slices.Sorted(maps.Keys(rec.Felder)) {
+		field(label, rec.Felder[label])
+	}
+	fmt.Fprintln(w, "\nKurzgutachten fields:")
+	if kgErr != nil {
+		fmt.Fprintln(w, "  failed:", kgErr)
+	}
+	for _, label := range slices.Sorted(maps.Keys(rec.Kurzgutachten)) {
+		field(label, strings.Join(rec.Kurzgutachten[label], "; "))
+	}
+
+	// Database state and what a run would do with the edikt.
+	now := time.Now()
+	fmt.Fprintln(w, "\nDatabase:")
+	state, err := db.Edikt(link)
+	if err != nil {
+		return err
+	}
+	tracked, err := db.Tracked(now)
+	if err != nil {
+		return err
+	}
+	recipients, err := db.Recipients(link)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		fmt.Fprintln(w, "  unknown, a run fetches it as new")
+	} else {
+		field("first seen", explainTime(state.FirstSeen.Local(), time.DateTime))
+		field("last fetched", explainTime(state.LastFetched.Local(), time.DateTime))
+		field("notified", explainTime(state.NotifiedAt.Local(), time.DateTime))
+		field("gone", explainTime(state.GoneAt.Local(), time.DateTime))
+		field("recipients", orDash(strings.Join(recipients, ", ")))
+		switch {
+		case slices.Contains(tracked, link):
+			fmt.Fprintln(w, "  tracked, a run fetches it to report changes")
+		case !db.NeedsFetch(link, time.Duration(cfg.Pipeline.Refresh), now):
+			fmt.Fprintln(w, "  known and fresh, a run skips it until",
+				state.LastFetched.Add(time.Duration(cfg.Pipeline.Refresh)).Local().Format(time.DateTime))
+		default:
+			fmt.Fprintln(w, "  stale, a run fetches it again")
+		}
+		if !state.NotifiedAt.IsZero() && len(recipients) == 0 {
+			fmt.Fprintln(w, "  notified before recipients were recorded, a match is not mailed again")
+		}
+	}
+
+	// Every check of every profile, in the order of filterItems.
+	recReason, recOK := checkRecord(rec)
+	entry := ListingEntry{Kategorie: findCategory(rec.Kategorie), Dienststelle: rec.Dienststelle}
+	for _, profile := range cfg.Profiles {
+		fmt.Fprintf(w, "\nProfile %q:", profile.Name)
+		if profile.Disabled {
+			fmt.Fprint(w, " (disabled)")
+		}
+		fmt.Fprintln(w)
+
+		accepted := true
+		check := func(name string, ok bool, detail string) {
+			result := "pass"
+			if !ok {
+				result, accepted = "FAIL", false
+			}
+			// Continuation lines, e.g. of a rule error, are indented to the detail column.
+			detail = strings.ReplaceAll(detail, "\n", "\n"+strings.Repeat(" ", 16))
+			fmt.Fprintf(w, "  %-4s  %-9s %s\n", result, name, detail)
+		}
+
+		reason, ok := profile.MatchListing(entry)
+		check("listing", ok, reason)
+		check("record", recOK, recReason)
+		reason, ok = profile.checkLimits(rec)
+		check("limits", ok, strings.TrimSpace(fmt.Sprintf("%s %d EUR, %d m²", reason, rec.Schaetzwert, profile.size(rec))))
+
+		// The distance needs both locations; without it the edikt is never accepted.
+		var km *int
+		home, homeErr := openstreetmap.Geocode(ctx, profile.Home)
+		switch {
+		case geoErr != nil:
+			check("distance", false, "edikt not geocoded")
+		case homeErr != nil:
+			check("distance", false, fmt.Sprintf("home %q not geocoded: %v", profile.Home, homeErr))
+		default:
+			d := int(openstreetmap.DistanceKM(loc, home))
+			km = &d
+			reason, ok = profile.CheckDistance(d)
+			check("distance", ok, strings.TrimSpace(fmt.Sprintf("%s %d km", reason, d)))
+		}
+
+		values := ruleValues(rec, km)
+		for i, prog := range profile.rules {
+			ok, err := prog.Eval(values)
+			detail := prog.String()
+			if err != nil {
+				detail = err.Error()
+			}
+			check(fmt.Sprintf("rule %d", i+1), ok && err == nil, detail)
+		}
+
+		if !accepted {
+			fmt.Fprintln(w, "  => rejected")
+			continue
+		}
+		fmt.Fprintln(w, "  => accepted")
+
+		// A match goes to each recipient of the profile that has not got it yet, like in notify.
+		tos := profile.Recipients
+		if len(tos) == 0 {
+			mailCfg, err := email.LoadMailConfig()
+			if err != nil {
+				fmt.Fprintln(w, "     default recipients unknown:", err)
+				continue
+			}
+			tos = mailCfg.To
+		}
+		for _, to := range tos {
+			to = strings.TrimSpace(to)
+			notified, err := db.Notified(link, to)
+			switch {
+			case err != nil:
+				return err
+			case notified:
+				fmt.Fprintf(w, "     %s: already mailed\n", to)
+			default:
+				fmt.Fprintf(w, "     %s: would be mailed\n", to)
+			}
+		}
+	}
+	return nil
+}
+
+// explainTime formats t with layout, or "–" for the zero time.
+func explainTime(t time.Time, layout string) string {
+	if t.IsZero() {
+		return "–"
+	}
+	return t.Format(layout)
+}
@@ -0,0 +1,75 @@
+// Package expr implements the small, side-effect free filter language of the search profiles.
+//
+// A rule is a boolean expression over named fields, for example
+//
+//	schaetzwert <= 30000 && grundgroesse >= 800 && entfernung_km < 60 && kategorie in ["UL", "LF"]
+//
+// Values are numbers, strings and booleans. The operators are, by increasing precedence:
+//
+//	||  or                      either side is true
+//	&&  and                     both sides are true
+//	!   not                     negation
+//	== != < <= > >=             comparison of two numbers or two strings
+//	in, not in                  membership in a list literal: x in [1, 2, 3]
+//	contains                    case-insensitive substring: plz_ort contains "linz"
+//	+ - * /                     arithmetic on numbers
+//
+// Numbers are written without thousands separators ("30000", not "30.000"); "true" and
+// "false" are the boolean literals. Rules are compiled against declared field types, so
+// typos and type errors are reported when the config is loaded, with the position in the rule.
+// Evaluation cannot loop, call functions or touch anything but the given values.
+package expr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type is the type of a field or expression.
+type Type int
+
+const (
+	Number Type = iota + 1 // float64; int values are accepted by Eval
+	String                 // string
+	Bool                   // bool
+	list                   // list literal, only valid on the right of "in"
+)
+
+func (t Type) String() string {
+	switch t {
+	case Number:
+		return "number"
+	case String:
+		return "text"
+	case Bool:
+		return "true/false"
+	case list:
+		return "list"
+	}
+	return "unknown"
+}
+
+// Fields declares the fields a rule may use and their types.
+type Fields map[string]Type
+
+// Error is a compile or evaluation error with its position in the rule.
+type Error struct {
+	Src string // the rule
+	Pos int    // byte offset of the error in Src
+	Msg string
+}
+
+// Error returns the message with the column and a caret marking the position, e.g.
+//
+//	column 16: expected a value, found "&&"
+//	  schaetzwert <= && x
+//	                 ^
+func (e *Error) Error() string {
+	col := column(e.Src, e.Pos)
+	return fmt.Sprintf("column %d: %s\n  %s\n  %s^", col, e.Msg, e.Src, strings.Repeat(" ", col-1))
+}
+
+// errorAt returns an *Error at pos.
+func errorAt(src string, pos int, format string, args ...any) *Error {
+	return &Error{Src: src, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
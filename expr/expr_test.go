@@ -0,0 +1,265 @@
+package expr
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testFields are the fields of the tests, a subset of the profile rule fields.
+var testFields = Fields{
+	"schaetzwert":   Number,
+	"grundgroesse":  Number,
+	"entfernung_km": Number,
+	"kategorie":     String,
+	"plz_ort":       String,
+	"verschoben":    Bool,
+}
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string // token texts, without the final tokEOF
+	}{
+		{`schaetzwert<=30000`, []string{"schaetzwert", "<=", "30000"}},
+		{`a >= 0.5 && !b`, []string{"a", ">=", "0.5", "&&", "!", "b"}},
+		{`kategorie in ["UL", 'LF']`, []string{"kategorie", "in", "[", "UL", ",", "LF", "]"}},
+		{`"sag \"hallo\""`, []string{`sag "hallo"`}},
+		{`größe`, []string{"größe"}},
+		{`0.125 1.5 12.3456 1000.5`, []string{"0.125", "1.5", "12.3456", "1000.5"}},
+		{``, nil},
+	}
+	for _, tt := range tests {
+		tokens, err := lex(tt.src)
+		if err != nil {
+			t.Errorf("lex(%q): %v", tt.src, err)
+			continue
+		}
+		var got []string
+		for _, tok := range tokens[:len(tokens)-1] {
+			got = append(got, tok.text)
+		}
+		if strings.Join(got, " | ") != strings.Join(tt.want, " | ") {
+			t.Errorf("lex(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+		if last := tokens[len(tokens)-1]; last.kind != tokEOF || last.pos != len(tt.src) {
+			t.Errorf("lex(%q) ends with %+v, want tokEOF at %d", tt.src, last, len(tt.src))
+		}
+	}
+}
+
+// TestLexThousands checks that only numbers that look like German thousands
+// separators are rejected, not fractions with three digits.
+func TestLexThousands(t *testing.T) {
+	tests := []struct {
+		src     string
+		wantErr string
+	}{
+		{`0.125`, ""},
+		{`1.5`, ""},
+		{`0.500`, ""},
+		{`1234.567`, ""},
+		{`1.2345`, ""},
+		{`30.000`, `write "30.000" without thousands separator, e.g. 30000`},
+		{`1.500`, `write "1.500" without thousands separator, e.g. 1500`},
+		{`1.250.000`, `write "1.250.000" without thousands separator, e.g. 1250000`},
+	}
+	for _, tt := range tests {
+		_, err := lex(tt.src)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("lex(%q) = %v, want %q", tt.src, err, tt.wantErr)
+		}
+	}
+}
+
+// TestCompileErrors checks the message, the column and the caret line of compile errors.
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		src    string
+		column int
+		msg    string // part of the message
+	}{
+		// Lexer
+		{"thousands separator", `schaetzwert <= 30.000`, 16, `write "30.000" without thousands separator, e.g. 30000`},
+		{"decimal comma", `grundgroesse > 0,5`, 17, "use a decimal point instead of a comma"},
+		{"lone =", `kategorie = "UL"`, 11, `unexpected character '=', use "==" to compare`},
+		{"lone &", `verschoben & true`, 12, `use "&&" or "and"`},
+		{"unclosed string", `kategorie == "UL`, 14, "missing closing \""},
+
+		// Parser
+		{"empty rule", `   `, 1, "empty rule"},
+		{"missing value", `schaetzwert <= && verschoben`, 16, `expected a value, found "&&"`},
+		{"missing value at end", `schaetzwert <=`, 15, `expected a value after "<=", found end of rule`},
+		{"unclosed paren", `(schaetzwert < 1 || verschoben`, 31, `expected ")" to close the "(" at column 1, found end of rule`},
+		{"unclosed list", `kategorie in ["UL" "LF"]`, 20, `expected "," or "]" in the list, found "LF"`},
+		{"missing operator", `verschoben verschoben`, 12, `unexpected "verschoben"; combine conditions with "&&" or "||"`},
+		{"chained comparison", `1 < schaetzwert < 2`, 17, "comparisons cannot be chained"},
+
+		// Checker
+		{"unknown field suggestion", `schätzwert < 1`, 1, `unknown field "schätzwert", did you mean "schaetzwert"?`},
+		{"unknown field list", `preis < 1`, 1, `unknown field "preis"; known fields are "entfernung_km", "grundgroesse",`},
+		{"empty list", `kategorie in []`, 14, "empty list"},
+		{"mixed list", `kategorie in ["UL", 1]`, 21, "list mixes text and number"},
+		{"compare number with text", `schaetzwert == "UL"`, 16, "cannot compare a number with a text"},
+		{"in with wrong element type", `schaetzwert in ["UL"]`, 16, "cannot look for a number in a list of text"},
+		{"compare with list", `kategorie == ["UL"]`, 11, `use "in" to compare with a list`},
+		{"and on numbers", `schaetzwert && verschoben`, 1, `"&&" needs true/false on both sides, found a number`},
+		{"arithmetic on text", `kategorie + 1 > 0`, 1, `"+" needs numbers, found a text`},
+		{"contains on number", `schaetzwert contains "1"`, 1, `"contains" needs a text on the left, found a number`},
+		{"not on number", `!schaetzwert`, 2, `"!" needs a true/false, found a number`},
+		{"ordered bool", `verschoben < true`, 12, "true/false values can only be compared with == and !="},
+		{"not boolean", `schaetzwert * 2`, 1, "must be true or false"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.src, testFields)
+			var e *Error
+			if !errors.As(err, &e) {
+				t.Fatalf("Compile(%q) = %v, want an *Error", tt.src, err)
+			}
+			if !strings.Contains(e.Msg, tt.msg) {
+				t.Errorf("message = %q, want it to contain %q", e.Msg, tt.msg)
+			}
+			if got := column(e.Src, e.Pos); got != tt.column {
+				t.Errorf("column = %d, want %d", got, tt.column)
+			}
+
+			// The caret sits under the column in the rule, both indented by two spaces.
+			lines := strings.Split(err.Error(), "\n")
+			if len(lines) != 3 {
+				t.Fatalf("error has %d lines, want 3:\n%s", len(lines), err)
+			}
+			if want := "  " + tt.src; lines[1] != want {
+				t.Errorf("source line = %q, want %q", lines[1], want)
+			}
+			if want := "  " + strings.Repeat(" ", tt.column-1) + "^"; lines[2] != want {
+				t.Errorf("caret line = %q, want %q", lines[2], want)
+			}
+		})
+	}
+}
+
+func TestErrorFormat(t *testing.T) {
+	_, err := Compile(`schaetzwert <= 30.000`, testFields)
+	want := "column 16: write \"30.000\" without thousands separator, e.g. 30000\n" +
+		"  schaetzwert <= 30.000\n" +
+		"                 ^"
+	if err == nil || err.Error() != want {
+		t.Errorf("error =\n%v\nwant\n%s", err, want)
+	}
+}
+
+func TestEval(t *testing.T) {
+	values := map[string]any{
+		"schaetzwert":   28500,
+		"grundgroesse":  812.0,
+		"entfernung_km": int64(27),
+		"kategorie":     "UL",
+		"plz_ort":       "4020 Linz",
+		"verschoben":    false,
+	}
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`schaetzwert <= 30000`, true},
+		{`schaetzwert < 28500`, false},
+		{`schaetzwert / grundgroesse < 40`, true},
+		{`schaetzwert - 500 == 28000`, true},
+		{`-schaetzwert < 0`, true},
+		{`1 + 2 * 3 == 7`, true},
+		{`(1 + 2) * 3 == 9`, true},
+		{`kategorie == "UL" && entfernung_km < 60`, true},
+		{`kategorie == "EW" || verschoben`, false},
+		{`not verschoben and kategorie != "EW"`, true},
+		{`kategorie in ["UL", "LF"]`, true},
+		{`kategorie in ["EW"]`, false},
+		{`kategorie not in ["EW", "EFH"]`, true},
+		{`entfernung_km in [10, 27]`, true},
+		{`plz_ort contains "linz"`, true},
+		{`plz_ort contains "wels"`, false},
+		{`kategorie < "WE"`, true},
+		{`verschoben == false`, true},
+	}
+	for _, tt := range tests {
+		p, err := Compile(tt.src, testFields)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.src, err)
+			continue
+		}
+		got, err := p.Eval(values)
+		if err != nil {
+			t.Errorf("Eval(%q): %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Eval(%q) = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+// TestEvalShortCircuit checks that the right side of && and || is only evaluated if needed:
+// a missing value there is no error if the left side decides.
+func TestEvalShortCircuit(t *testing.T) {
+	tests := []struct {
+		src     string
+		want    bool
+		wantErr bool
+	}{
+		{`verschoben && entfernung_km < 60`, false, false},
+		{`!verschoben || entfernung_km < 60`, true, false},
+		{`!verschoben && entfernung_km < 60`, false, true},
+		{`verschoben || entfernung_km < 60`, false, true},
+	}
+	values := map[string]any{"verschoben": false}
+	for _, tt := range tests {
+		p, err := Compile(tt.src, testFields)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.src, err)
+		}
+		got, err := p.Eval(values)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Eval(%q) = %v, %v; want %v, error %v", tt.src, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		src    string
+		values map[string]any
+		column int
+		msg    string
+	}{
+		{`schaetzwert / grundgroesse > 1`, map[string]any{"schaetzwert": 1, "grundgroesse": 0}, 13, "division by zero"},
+		{`schaetzwert > 1`, map[string]any{}, 1, `no value for "schaetzwert"`},
+		{`schaetzwert > 1`, map[string]any{"schaetzwert": "1"}, 1, `value of "schaetzwert" is a string, want a number`},
+		{`kategorie == "UL"`, map[string]any{"kategorie": 1}, 1, `value of "kategorie" is a float64, want a text`},
+	}
+	for _, tt := range tests {
+		p, err := Compile(tt.src, testFields)
+		if err != nil {
+			t.Fatalf("Compile(%q): %v", tt.src, err)
+		}
+		_, err = p.Eval(tt.values)
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("Eval(%q) = %v, want an *Error", tt.src, err)
+			continue
+		}
+		if !strings.Contains(e.Msg, tt.msg) || column(e.Src, e.Pos) != tt.column {
+			t.Errorf("Eval(%q) = %q at column %d, want %q at column %d", tt.src, e.Msg, column(e.Src, e.Pos), tt.msg, tt.column)
+		}
+	}
+}
+
+func TestProgramFields(t *testing.T) {
+	p, err := Compile(`plz_ort contains "linz" || schaetzwert < 1 && plz_ort != ""`, testFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(p.Fields(), ","); got != "plz_ort,schaetzwert" {
+		t.Errorf("Fields() = %q, want plz_ort,schaetzwert", got)
+	}
+}
@@ -0,0 +1,147 @@
+package expr
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenKind classifies a token.
+type tokenKind int
+
+const (
+	tokEOF    tokenKind = iota
+	tokNumber           // 30000, 0.5
+	tokString           // "UL", 'Linz'
+	tokIdent            // field names and keywords (and, or, not, in, contains, true, false)
+	tokOp               // operators and punctuation
+)
+
+// token is one lexical element of an expression.
+type token struct {
+	kind tokenKind
+	text string // source text; for strings the unquoted value
+	pos  int    // byte offset in the source
+}
+
+// describe returns the token as shown in error messages.
+func (t token) describe() string {
+	if t.kind == tokEOF {
+		return "end of rule"
+	}
+	return `"` + t.text + `"`
+}
+
+// operators lists all operators, longest first so "<=" wins over "<".
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "(", ")", "[", "]", ","}
+
+// lex splits src into tokens. The last token is always tokEOF.
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+
+		case r >= '0' && r <= '9':
+			// Digits with an optional fraction. "30.000" and "1.250.000" look like German
+			// thousands separators and are rejected to avoid reading them as 30 and 1.25;
+			// a leading zero as in "0.125" is a plain fraction.
+			start := i
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+			if groups := thousandsGroups(src[i:]); groups > 0 && i-start <= 3 && src[start] != '0' {
+				end := i + 4*groups
+				return nil, errorAt(src, start, "write %q without thousands separator, e.g. %s",
+					src[start:end], strings.ReplaceAll(src[start:end], ".", ""))
+			}
+			if i < len(src) && src[i] == '.' {
+				i++
+				digits := i
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+				if i == digits {
+					return nil, errorAt(src, i, "expected digits after the decimal point")
+				}
+			}
+			if i < len(src) && src[i] == ',' && i+1 < len(src) && isDigit(src[i+1]) {
+				return nil, errorAt(src, i, "use a decimal point instead of a comma")
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[start:i], pos: start})
+
+		case r == '"' || r == '\'':
+			start := i
+			var b strings.Builder
+			i += size
+			for {
+				if i >= len(src) {
+					return nil, errorAt(src, start, "missing closing %c", r)
+				}
+				c, n := utf8.DecodeRuneInString(src[i:])
+				i += n
+				if c == r {
+					break
+				}
+				if c == '\\' && i < len(src) {
+					c, n = utf8.DecodeRuneInString(src[i:])
+					i += n
+				}
+				b.WriteRune(c)
+			}
+			tokens = append(tokens, token{kind: tokString, text: b.String(), pos: start})
+
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(src) {
+				c, n := utf8.DecodeRuneInString(src[i:])
+				if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' {
+					break
+				}
+				i += n
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[start:i], pos: start})
+
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				hint := ""
+				switch r {
+				case '=':
+					hint = `, use "==" to compare`
+				case '&':
+					hint = `, use "&&" or "and"`
+				case '|':
+					hint = `, use "||" or "or"`
+				}
+				return nil, errorAt(src, i, "unexpected character %q%s", r, hint)
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+// thousandsGroups returns the number of ".ddd" groups that s starts with,
+// each of exactly three digits.
+func thousandsGroups(s string) int {
+	groups := 0
+	for len(s) >= 4 && s[0] == '.' && isDigit(s[1]) && isDigit(s[2]) && isDigit(s[3]) && (len(s) == 4 || !isDigit(s[4])) {
+		groups++
+		s = s[4:]
+	}
+	return groups
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
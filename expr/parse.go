@@ -0,0 +1,324 @@
+package expr
+
+import (
+	"strconv"
+	"strings"
+)
+
+// node is an element of the syntax tree.
+type node interface {
+	position() int
+}
+
+type (
+	numberLit struct {
+		pos int
+		v   float64
+	}
+	stringLit struct {
+		pos int
+		v   string
+	}
+	boolLit struct {
+		pos int
+		v   bool
+	}
+	field struct {
+		pos  int
+		name string
+	}
+	listLit struct {
+		pos   int
+		elems []node
+	}
+	unary struct {
+		pos int
+		op  string // "!" or "-"
+		x   node
+	}
+	binary struct {
+		pos  int
+		op   string // operator as written, keywords normalized: "&&", "||", "in", "not in", "contains", ...
+		x, y node
+	}
+)
+
+func (n *numberLit) position() int { return n.pos }
+func (n *stringLit) position() int { return n.pos }
+func (n *boolLit) position() int   { return n.pos }
+func (n *field) position() int     { return n.pos }
+func (n *listLit) position() int   { return n.pos }
+func (n *unary) position() int     { return n.pos }
+func (n *binary) position() int    { return n.pos }
+
+// parser is a recursive descent parser with one token lookahead.
+//
+//	or      = and { ("||" | "or") and }
+//	and     = not { ("&&" | "and") not }
+//	not     = ("!" | "not") not | compare
+//	compare = sum [ ("==" | "!=" | "<" | "<=" | ">" | ">=" | "in" | "not" "in" | "contains") sum ]
+//	sum     = product { ("+" | "-") product }
+//	product = unary { ("*" | "/") unary }
+//	unary   = "-" unary | primary
+//	primary = number | string | "true" | "false" | field | list | "(" or ")"
+//	list    = "[" [ or { "," or } [ "," ] ] "]"
+type parser struct {
+	src    string
+	tokens []token
+	i      int
+}
+
+// peek returns the current token.
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+// next consumes and returns the current token.
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// is reports whether the current token is the operator or keyword s.
+func (p *parser) is(s ...string) bool {
+	t := p.peek()
+	if t.kind != tokOp && t.kind != tokIdent {
+		return false
+	}
+	for _, v := range s {
+		if t.text == v {
+			return true
+		}
+	}
+	return false
+}
+
+// parse parses src into a syntax tree.
+func parse(src string) (node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: src, tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, errorAt(src, 0, "empty rule")
+	}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		hint := ""
+		if t.kind == tokIdent || t.kind == tokNumber || t.kind == tokString {
+			hint = `; combine conditions with "&&" or "||"`
+		}
+		return nil, errorAt(src, t.pos, "unexpected %s%s", t.describe(), hint)
+	}
+	return n, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	x, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("||", "or") {
+		op := p.next()
+		y, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{pos: op.pos, op: "||", x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	x, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("&&", "and") {
+		op := p.next()
+		y, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{pos: op.pos, op: "&&", x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.is("!", "not") {
+		op := p.next()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{pos: op.pos, op: "!", x: x}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (node, error) {
+	x, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+
+	op := p.peek()
+	switch {
+	case p.is("==", "!=", "<", "<=", ">", ">=", "in", "contains"):
+		p.next()
+	case p.is("not") && p.tokens[p.i+1].kind == tokIdent && p.tokens[p.i+1].text == "in":
+		p.next()
+		p.next()
+		op.text = "not in"
+	default:
+		return x, nil
+	}
+
+	y, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	n := &binary{pos: op.pos, op: op.text, x: x, y: y}
+
+	// Comparisons do not chain: "a < b < c" is almost always a mistake.
+	if p.is("==", "!=", "<", "<=", ">", ">=") {
+		return nil, errorAt(p.src, p.peek().pos, `comparisons cannot be chained, use "a < b && b < c"`)
+	}
+	return n, nil
+}
+
+func (p *parser) parseSum() (node, error) {
+	x, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("+", "-") {
+		op := p.next()
+		y, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{pos: op.pos, op: op.text, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseProduct() (node, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("*", "/") {
+		op := p.next()
+		y, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		x = &binary{pos: op.pos, op: op.text, x: x, y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.is("-") {
+		op := p.next()
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{pos: op.pos, op: "-", x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, errorAt(p.src, t.pos, "invalid number %q", t.text)
+		}
+		return &numberLit{pos: t.pos, v: v}, nil
+
+	case tokString:
+		return &stringLit{pos: t.pos, v: t.text}, nil
+
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			return &boolLit{pos: t.pos, v: t.text == "true"}, nil
+		case "and", "or", "not", "in", "contains":
+			return nil, errorAt(p.src, t.pos, "expected a value before %s", t.describe())
+		}
+		return &field{pos: t.pos, name: t.text}, nil
+
+	case tokOp:
+		switch t.text {
+		case "(":
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.is(")") {
+				return nil, errorAt(p.src, p.peek().pos, `expected ")" to close the "(" at column %d, found %s`,
+					column(p.src, t.pos), p.peek().describe())
+			}
+			p.next()
+			return x, nil
+
+		case "[":
+			l := &listLit{pos: t.pos}
+			for !p.is("]") {
+				x, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				l.elems = append(l.elems, x)
+				if !p.is(",") {
+					break
+				}
+				p.next()
+			}
+			if !p.is("]") {
+				return nil, errorAt(p.src, p.peek().pos, `expected "," or "]" in the list, found %s`, p.peek().describe())
+			}
+			p.next()
+			return l, nil
+		}
+	}
+
+	// Point at the token that is out of place.
+	if t.kind == tokEOF {
+		prev := p.tokens[max(p.i-1, 0)]
+		if prev.kind == tokOp {
+			return nil, errorAt(p.src, t.pos, "expected a value after %s, found end of rule", prev.describe())
+		}
+	}
+	return nil, errorAt(p.src, t.pos, "expected a value, found %s", t.describe())
+}
+
+// column returns the 1-based column of the byte offset pos.
+func column(src string, pos int) int {
+	return len([]rune(src[:pos])) + 1
+}
+
+// quoteList formats names for error messages: "a", "b" and "c".
+func quoteList(names []string) string {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = strconv.Quote(n)
+	}
+	if len(quoted) <= 1 {
+		return strings.Join(quoted, "")
+	}
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " and " + quoted[len(quoted)-1]
+}
@@ -0,0 +1,373 @@
+package expr
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Program is a compiled rule.
+type Program struct {
+	src    string
+	root   node
+	types  Fields   // declared types, checked against the values in Eval
+	fields []string // fields used by the rule, sorted
+}
+
+// Compile parses src and checks it against the declared fields.
+// The rule must be a boolean expression. Errors are *Error values with the position in src.
+func Compile(src string, fields Fields) (*Program, error) {
+	root, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	c := &checker{src: src, fields: fields, used: make(map[string]bool)}
+	t, err := c.check(root)
+	if err != nil {
+		return nil, err
+	}
+	if t != Bool {
+		return nil, errorAt(src, 0, "the rule is a %s, but must be true or false; compare it, e.g. %q", t, "... >= 100")
+	}
+	return &Program{src: src, root: root, types: fields, fields: slices.Sorted(maps.Keys(c.used))}, nil
+}
+
+// String returns the source of the rule.
+func (p *Program) String() string {
+	return p.src
+}
+
+// Fields returns the names of the fields the rule uses, sorted.
+func (p *Program) Fields() []string {
+	return p.fields
+}
+
+// checker infers and checks the types of a syntax tree.
+type checker struct {
+	src    string
+	fields Fields
+	used   map[string]bool
+}
+
+func (c *checker) check(n node) (Type, error) {
+	switch n := n.(type) {
+	case *numberLit:
+		return Number, nil
+	case *stringLit:
+		return String, nil
+	case *boolLit:
+		return Bool, nil
+
+	case *field:
+		t, ok := c.fields[n.name]
+		if !ok {
+			return 0, c.unknownField(n)
+		}
+		c.used[n.name] = true
+		return t, nil
+
+	case *listLit:
+		if len(n.elems) == 0 {
+			return 0, errorAt(c.src, n.pos, "empty list")
+		}
+		first, err := c.check(n.elems[0])
+		if err != nil {
+			return 0, err
+		}
+		if first != Number && first != String {
+			return 0, errorAt(c.src, n.elems[0].position(), "lists may only contain numbers or texts")
+		}
+		for _, e := range n.elems[1:] {
+			t, err := c.check(e)
+			if err != nil {
+				return 0, err
+			}
+			if t != first {
+				return 0, errorAt(c.src, e.position(), "list mixes %s and %s", first, t)
+			}
+		}
+		return list, nil
+
+	case *unary:
+		t, err := c.check(n.x)
+		if err != nil {
+			return 0, err
+		}
+		want := Bool
+		if n.op == "-" {
+			want = Number
+		}
+		if t != want {
+			return 0, errorAt(c.src, n.x.position(), "%q needs a %s, found a %s", n.op, want, t)
+		}
+		return want, nil
+
+	case *binary:
+		return c.checkBinary(n)
+	}
+	panic(fmt.Sprintf("expr: unknown node %T", n))
+}
+
+func (c *checker) checkBinary(n *binary) (Type, error) {
+	x, err := c.check(n.x)
+	if err != nil {
+		return 0, err
+	}
+	y, err := c.check(n.y)
+	if err != nil {
+		return 0, err
+	}
+	if x == list {
+		return 0, errorAt(c.src, n.x.position(), `a list can only follow "in"`)
+	}
+
+	switch n.op {
+	case "&&", "||":
+		if x != Bool {
+			return 0, errorAt(c.src, n.x.position(), "%q needs true/false on both sides, found a %s", n.op, x)
+		}
+		if y != Bool {
+			return 0, errorAt(c.src, n.y.position(), "%q needs true/false on both sides, found a %s", n.op, y)
+		}
+		return Bool, nil
+
+	case "+", "-", "*", "/":
+		if x != Number {
+			return 0, errorAt(c.src, n.x.position(), "%q needs numbers, found a %s", n.op, x)
+		}
+		if y != Number {
+			return 0, errorAt(c.src, n.y.position(), "%q needs numbers, found a %s", n.op, y)
+		}
+		return Number, nil
+
+	case "==", "!=", "<", "<=", ">", ">=":
+		if y == list {
+			return 0, errorAt(c.src, n.pos, `use "in" to compare with a list`)
+		}
+		if x != y {
+			return 0, errorAt(c.src, n.y.position(), "cannot compare a %s with a %s", x, y)
+		}
+		if x == Bool && n.op != "==" && n.op != "!=" {
+			return 0, errorAt(c.src, n.pos, "true/false values can only be compared with == and !=")
+		}
+		return Bool, nil
+
+	case "in", "not in":
+		l, ok := n.y.(*listLit)
+		if !ok {
+			return 0, errorAt(c.src, n.y.position(), `%q needs a list like ["UL", "LF"]`, n.op)
+		}
+		if elem, _ := c.check(l.elems[0]); elem != x {
+			return 0, errorAt(c.src, n.y.position(), "cannot look for a %s in a list of %s", x, elem)
+		}
+		return Bool, nil
+
+	case "contains":
+		if x != String {
+			return 0, errorAt(c.src, n.x.position(), `"contains" needs a text on the left, found a %s`, x)
+		}
+		if y != String {
+			return 0, errorAt(c.src, n.y.position(), `"contains" needs a text on the right, found a %s`, y)
+		}
+		return Bool, nil
+	}
+	panic("expr: unknown operator " + n.op)
+}
+
+// unknownField reports an undeclared field with the closest declared name, or all names.
+func (c *checker) unknownField(n *field) error {
+	names := slices.Sorted(maps.Keys(c.fields))
+
+	// Suggest only close matches: about one typo per three letters.
+	// Umlauts are spelled out like in the field names ("größe" -> "groesse").
+	typed := umlauts.Replace(strings.ToLower(n.name))
+	best, bestDist := "", len([]rune(typed))/3+1
+	for _, name := range names {
+		if d := distance(typed, name); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	if best != "" {
+		return errorAt(c.src, n.pos, "unknown field %q, did you mean %q?", n.name, best)
+	}
+	return errorAt(c.src, n.pos, "unknown field %q; known fields are %s", n.name, quoteList(names))
+}
+
+// umlauts spells out German special characters.
+var umlauts = strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss")
+
+// distance returns the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// Eval evaluates the rule with the given field values.
+// Values are float64 or int for Number fields, string for String and bool for Bool fields.
+// A missing or mistyped value, and a division by zero, return an *Error.
+func (p *Program) Eval(values map[string]any) (bool, error) {
+	v, err := p.eval(p.root, values)
+	if err != nil {
+		return false, err
+	}
+	return v.(bool), nil
+}
+
+func (p *Program) eval(n node, values map[string]any) (any, error) {
+	switch n := n.(type) {
+	case *numberLit:
+		return n.v, nil
+	case *stringLit:
+		return n.v, nil
+	case *boolLit:
+		return n.v, nil
+
+	case *field:
+		v, ok := values[n.name]
+		if !ok {
+			return nil, errorAt(p.src, n.pos, "no value for %q", n.name)
+		}
+		var t Type
+		switch x := v.(type) {
+		case int:
+			v, t = float64(x), Number
+		case int64:
+			v, t = float64(x), Number
+		case float64:
+			t = Number
+		case string:
+			t = String
+		case bool:
+			t = Bool
+		}
+		if t != p.types[n.name] {
+			return nil, errorAt(p.src, n.pos, "value of %q is a %T, want a %s", n.name, v, p.types[n.name])
+		}
+		return v, nil
+
+	case *listLit:
+		// Only evaluated as the right side of "in", see below.
+		panic("expr: list outside of in")
+
+	case *unary:
+		x, err := p.eval(n.x, values)
+		if err != nil {
+			return nil, err
+		}
+		if n.op == "!" {
+			return !x.(bool), nil
+		}
+		return -x.(float64), nil
+
+	case *binary:
+		return p.evalBinary(n, values)
+	}
+	panic(fmt.Sprintf("expr: unknown node %T", n))
+}
+
+func (p *Program) evalBinary(n *binary, values map[string]any) (any, error) {
+	x, err := p.eval(n.x, values)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short-circuit the logical operators.
+	switch n.op {
+	case "&&":
+		if !x.(bool) {
+			return false, nil
+		}
+		return p.eval(n.y, values)
+	case "||":
+		if x.(bool) {
+			return true, nil
+		}
+		return p.eval(n.y, values)
+	case "in", "not in":
+		found := false
+		for _, e := range n.y.(*listLit).elems {
+			v, err := p.eval(e, values)
+			if err != nil {
+				return nil, err
+			}
+			if v == x {
+				found = true
+				break
+			}
+		}
+		return found == (n.op == "in"), nil
+	}
+
+	y, err := p.eval(n.y, values)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "+":
+		return x.(float64) + y.(float64), nil
+	case "-":
+		return x.(float64) - y.(float64), nil
+	case "*":
+		return x.(float64) * y.(float64), nil
+	case "/":
+		if y.(float64) == 0 {
+			return nil, errorAt(p.src, n.pos, "division by zero")
+		}
+		return x.(float64) / y.(float64), nil
+	case "contains":
+		return strings.Contains(strings.ToLower(x.(string)), strings.ToLower(y.(string))), nil
+	case "==":
+		return x == y, nil
+	case "!=":
+		return x != y, nil
+	}
+
+	// Ordered comparison of two numbers or two strings.
+	var cmp int
+	switch x := x.(type) {
+	case float64:
+		cmp = compare(x, y.(float64))
+	case string:
+		cmp = strings.Compare(x, y.(string))
+	}
+	switch n.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+	panic("expr: unknown operator " + n.op)
+}
+
+// compare returns -1, 0 or +1.
+func compare(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Kurzgutachten is the structured content of a short appraisal page.
+// Fields maps every label of fieldLabels found in the text to its values in text order,
+// e.g. "Stichtag" -> ["12.03.2025"]. Labels that occur several times, like one
+// "Grundstücksnr." per parcel, keep all their values.
+type Kurzgutachten struct {
+	Fields map[string][]string `json:"fields"`
+}
+
+// reKurzgutachtenLabel matches a known label with its colon at the start of a line,
+// where CleanText puts every label of fieldLabels.
+var reKurzgutachtenLabel = regexp.MustCompile(`(?m)^(` + strings.Join(fieldLabels, "|") + `):[ \t]*`)
+
+// ParseKurzgutachten splits the cleaned text of a short appraisal (see CleanText) into its fields.
+// A value runs from its label to the next label or the next empty line; line breaks
+// inside a value are replaced by spaces. Text before the first label is ignored.
+func ParseKurzgutachten(text string) *Kurzgutachten {
+	k := &Kurzgutachten{Fields: make(map[string][]string)}
+
+	matches := reKurzgutachtenLabel.FindAllStringSubmatchIndex(text, -1)
+	for i, m := range matches {
+		// The value ends where the next label starts.
+		end := len(text)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		value := text[m[1]:end]
+
+		// An empty line ends the field block; what follows is prose or footer noise.
+		if cut := strings.Index(value, "\n\n"); cut >= 0 {
+			value = value[:cut]
+		}
+		value = strings.Join(strings.Fields(value), " ")
+		if value == "" {
+			continue
+		}
+
+		label := text[m[2]:m[3]]
+		k.Fields[label] = append(k.Fields[label], value)
+	}
+	return k
+}
+
+// Get returns the first value of label, or an empty string.
+func (k *Kurzgutachten) Get(label string) string {
+	if values := k.Fields[label]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Stichtag returns the valuation date, or the zero time if it is missing or not parseable.
+func (k *Kurzgutachten) Stichtag() time.Time {
+	return parseTermin(k.Get("Stichtag"))
+}
+
+// Zubehoerwert returns the value of the accessories auctioned together with the property
+// ("Wert des mitzuversteigernden Zubehörs") in EUR. See parseEuro for the result convention.
+func (k *Kurzgutachten) Zubehoerwert() int {
+	return parseEuro(k.Get("Wert des mitzuversteigernden Zubehörs"))
+}
+
+// parseEuro is parseInt for amounts that may carry a leading currency, e.g. "EUR 1.500,00" or "€ 1.500".
+func parseEuro(value string) int {
+	value = strings.TrimSpace(value)
+	value = strings.TrimPrefix(value, "EUR")
+	value = strings.TrimPrefix(value, "€")
+	return parseInt(strings.TrimSpace(value))
+}
+
+// kurzgutachtenText fetches a short appraisal page and returns its cleaned text.
+func kurzgutachtenText(ctx context.Context, link string) (string, error) {
+	doc, _, _, err := RequestPage(ctx, link)
+	if err != nil {
+		return "", err
+	}
+	txt := doc.Find("body").Text()
+	return CleanText(txt), nil
+}
+
+// FetchKurzgutachten downloads and parses the short appraisal of rec and merges it into rec.
+// Records without a Kurzgutachten link are left unchanged.
+func FetchKurzgutachten(ctx context.Context, rec *EdiktRecord) error {
+	if rec.KurzgutachtenLink == "" {
+		return nil
+	}
+	text, err := kurzgutachtenText(ctx, rec.KurzgutachtenLink)
+	if err != nil {
+		return err
+	}
+	rec.MergeKurzgutachten(ParseKurzgutachten(text))
+	return nil
+}
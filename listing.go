@@ -0,0 +1,211 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Listing is one parsed search result page.
+type Listing struct {
+	URL       string         // URL of the search result page
+	Total     int            // total number of hits reported by the portal, -1 if the page does not show it
+	Entries   []ListingEntry // result rows in page order, one per edikt
+	Truncated bool           // the portal cut the result set and the query could not be split further
+}
+
+// truncated reports whether the page looks cut off: it hit the result cap
+// or the portal reports more hits than it returned.
+func (l *Listing) truncated(limit int) bool {
+	return len(l.Entries) >= limit || l.Total > len(l.Entries)
+}
+
+// ListingEntry is the summary of one edikt as shown in a search result row.
+// It allows cheap filtering before the detail page is fetched.
+// Fields the row does not show are left empty.
+type ListingEntry struct {
+	URL          string   `json:"url"`                    // absolute "alldoc" URL of the detail page
+	Dienststelle string   `json:"dienststelle,omitempty"` // court, e.g. "BG Linz"
+	Datum        string   `json:"datum,omitempty"`        // date shown in the row, "DD.MM.YYYY"
+	Objekt       string   `json:"objekt,omitempty"`       // object summary, usually the link text
+	Kategorie    Category `json:"kategorie,omitempty"`    // category from a category column or an explicit "(XX)" code
+	Cells        []string `json:"cells,omitempty"`        // plain text of every cell of the row
+}
+
+// ParseListing extracts all result rows from a search result page.
+// Rows are found via their "alldoc..." link, which is resolved against base; the remaining
+// cells are assigned by the table header if there is one, otherwise by their content.
+// Site context: https://edikte.justiz.gv.at/edikte/
+func ParseListing(doc *goquery.Document, base *url.URL) *Listing {
+	listing := &Listing{
+		URL:   base.String(),
+		Total: parseTotal(pageText(doc)),
+	}
+
+	// Iterate all anchors that have an href attribute
+	doc.Find("a[href]").Each(func(i int, a *goquery.Selection) {
+		// Only consider links starting with "alldoc"
+		href, ok := a.Attr("href")
+		if !ok || !strings.HasPrefix(href, "alldoc") {
+			return
+		}
+
+		// Parse and resolve to absolute URL; ignore parse errors per original behavior
+		rel, _ := url.Parse(href)
+		entry := ListingEntry{
+			URL:    base.ResolveReference(rel).String(),
+			Objekt: cleanCell(a.Text()),
+		}
+
+		// A row may link its edikt more than once, e.g. from the court and the object;
+		// count it once, so truncated compares hits, not links.
+		if i := slices.IndexFunc(listing.Entries, func(e ListingEntry) bool { return e.URL == entry.URL }); i >= 0 {
+			if listing.Entries[i].Objekt == "" {
+				listing.Entries[i].Objekt = entry.Objekt
+			}
+			return
+		}
+
+		// The result row is a table row on the classic layout and a div.row on the responsive one.
+		row := a.Closest("tr")
+		cells := row.Find("td")
+		if row.Length() == 0 {
+			row = a.Closest("div.row")
+			cells = row.Children()
+		}
+		headers := row.Closest("table").Find("th")
+
+		cells.Each(func(j int, cell *goquery.Selection) {
+			txt := cleanCell(cell.Text())
+			entry.Cells = append(entry.Cells, txt)
+			if txt == "" {
+				return
+			}
+
+			// Prefer the column header, fall back to recognizing the content.
+			header := strings.ToLower(cleanCell(headers.Eq(j).Text()))
+			switch {
+			case strings.Contains(header, "dienststelle") || strings.Contains(header, "gericht"):
+				entry.Dienststelle = txt
+			case strings.Contains(header, "datum") || strings.Contains(header, "termin"):
+				entry.Datum = reListingDate.FindString(txt)
+			case strings.Contains(header, "kategorie") || strings.Contains(header, "objektart"):
+				entry.Kategorie = categoryCell(txt)
+			case header == "" && entry.Dienststelle == "" && reCourt.MatchString(txt):
+				entry.Dienststelle = txt
+			case header == "" && entry.Datum == "" && reListingDate.MatchString(txt):
+				entry.Datum = reListingDate.FindString(txt)
+			}
+		})
+
+		// Without a category column, only an explicit code counts. Guessing from labels in
+		// free text could reject a real hit, and the search is restricted by category anyway.
+		if entry.Kategorie == "" {
+			entry.Kategorie = categoryCode(strings.Join(entry.Cells, " ") + " " + entry.Objekt)
+		}
+		listing.Entries = append(listing.Entries, entry)
+	})
+
+	return listing
+}
+
+var (
+	// reListingDate matches a date like "12.11.2025".
+	reListingDate = regexp.MustCompile(`\d{1,2}\.\d{1,2}\.\d{4}`)
+	// reCourt matches court names like "BG Linz", "LG Wels" or "Bezirksgericht Freistadt".
+	reCourt = regexp.MustCompile(`^(BG|LG|LGZ|HG|Bezirksgericht|Landesgericht)\b`)
+	// reTotal matches hit counts like "123 Treffer", "Treffer: 123" or "Treffer 1 - 50 von 123".
+	// A bare "von 123" is no hit count: object texts say "Wohnung von 120 m²".
+	reTotal = regexp.MustCompile(`(?i)(\d+)\s+Treffer|Treffer:?\s*(?:\d+\s*[-–]\s*\d+\s+von\s+)?(\d+)`)
+	// reCategoryCode matches a category code in parentheses, e.g. "(UL)".
+	reCategoryCode = regexp.MustCompile(`\(([A-Z]{2})\)`)
+)
+
+// pageText returns the text of the page without the result rows, so object texts
+// cannot be taken for the hit count.
+func pageText(doc *goquery.Document) string {
+	body := doc.Find("body").Clone()
+	body.Find(`a[href^="alldoc"]`).Each(func(_ int, a *goquery.Selection) {
+		a.Closest("tr, div.row").Remove()
+	})
+	return body.Text()
+}
+
+// parseTotal returns the total hit count of an explicit "Treffer" phrase, or -1 if there is none.
+func parseTotal(text string) int {
+	m := reTotal.FindStringSubmatch(text)
+	if m == nil {
+		return -1
+	}
+	for _, g := range m[1:] {
+		if n, err := strconv.Atoi(g); err == nil {
+			return n
+		}
+	}
+	return -1
+}
+
+// findCategory recognizes a category by its code in parentheses or by its portal label.
+// Returns an empty Category if the text names none, or several different ones.
+// It suits the Kategorie field of the detail page; free text may name a label in passing.
+func findCategory(text string) Category {
+	if codes := categoryCodes(text); len(codes) > 0 {
+		return single(codes)
+	}
+	lower := strings.ToLower(text)
+	var labels []Category
+	for c, name := range categoryNames {
+		if strings.Contains(lower, strings.ToLower(name)) {
+			labels = append(labels, c)
+		}
+	}
+	return single(labels)
+}
+
+// categoryCode returns the category of the known code in parentheses, e.g. "(UL)",
+// or an empty Category if there is none or several different ones.
+func categoryCode(text string) Category {
+	return single(categoryCodes(text))
+}
+
+// categoryCodes returns the distinct known codes in parentheses in text, in order.
+func categoryCodes(text string) []Category {
+	var codes []Category
+	for _, m := range reCategoryCode.FindAllStringSubmatch(text, -1) {
+		if c := Category(m[1]); c.Valid() && !slices.Contains(codes, c) {
+			codes = append(codes, c)
+		}
+	}
+	return codes
+}
+
+// single returns the only element of cs, or an empty Category if cs is empty or ambiguous.
+func single(cs []Category) Category {
+	if len(cs) != 1 {
+		return ""
+	}
+	return cs[0]
+}
+
+// categoryCell returns the category of a category column: its code in parentheses
+// or its exact portal label. Returns an empty Category for anything else.
+func categoryCell(text string) Category {
+	if c := categoryCode(text); c != "" {
+		return c
+	}
+	for c, name := range categoryNames {
+		if strings.EqualFold(text, name) {
+			return c
+		}
+	}
+	return ""
+}
+
+// cleanCell collapses all whitespace (including NBSP) in a cell text to single spaces.
+func cleanCell(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// parseListingHTML parses src as a search result page of the portal.
+func parseListingHTML(t *testing.T, src string) *Listing {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _ := url.Parse("https://edikte.justiz.gv.at/edikte/ex/exedi3.nsf/suche")
+	return ParseListing(doc, base)
+}
+
+func TestParseListingCategory(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want Category
+	}{
+		{
+			name: "category column with label",
+			html: `<table><tr><th>Dienststelle</th><th>Objektart</th><th>Objekt</th></tr>
+				<tr><td>BG Linz</td><td>Unbebaute Liegenschaft</td><td><a href="alldoc/1!OpenDocument">4020 Linz</a></td></tr></table>`,
+			want: CategoryUnbebaut,
+		},
+		{
+			name: "category column with code",
+			html: `<table><tr><th>Kategorie</th><th>Objekt</th></tr>
+				<tr><td>Eigentumswohnung (EW)</td><td><a href="alldoc/1!OpenDocument">4020 Linz</a></td></tr></table>`,
+			want: CategoryEigentumswohnung,
+		},
+		{
+			name: "explicit code in free text",
+			html: `<table><tr><td>BG Linz</td><td><a href="alldoc/1!OpenDocument">Grundstück in Linz (UL)</a></td></tr></table>`,
+			want: CategoryUnbebaut,
+		},
+		{
+			name: "label in free text is not trusted",
+			html: `<table><tr><td>BG Linz</td><td><a href="alldoc/1!OpenDocument">Einfamilienhaus mit Baurecht</a></td></tr></table>`,
+			want: "",
+		},
+		{
+			name: "several codes in free text",
+			html: `<table><tr><td>BG Linz</td><td><a href="alldoc/1!OpenDocument">Haus (EH) mit Bauplatz (UL)</a></td></tr></table>`,
+			want: "",
+		},
+		{
+			name: "unknown text in category column",
+			html: `<table><tr><th>Kategorie</th><th>Objekt</th></tr>
+				<tr><td>Wohnung mit Garten</td><td><a href="alldoc/1!OpenDocument">4020 Linz</a></td></tr></table>`,
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := parseListingHTML(t, tt.html)
+			if len(l.Entries) != 1 {
+				t.Fatalf("got %d entries, want 1", len(l.Entries))
+			}
+			if got := l.Entries[0].Kategorie; got != tt.want {
+				t.Errorf("Kategorie = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchListingWithoutCategory(t *testing.T) {
+	p := Profile{Categories: []Category{CategoryUnbebaut}}
+	l := parseListingHTML(t, `<table><tr><td>BG Linz</td><td><a href="alldoc/1!OpenDocument">Eigentumswohnung, 80 m²</a></td></tr></table>`)
+	if reason, ok := p.MatchListing(l.Entries[0]); !ok {
+		t.Errorf("MatchListing rejected a row without category: %s", reason)
+	}
+}
+
+func TestParseListingTotal(t *testing.T) {
+	src, err := os.ReadFile("testdata/listing.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := parseListingHTML(t, string(src))
+	if len(l.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(l.Entries))
+	}
+	if l.Total != 2 {
+		t.Errorf("Total = %d, want 2", l.Total)
+	}
+	if l.truncated(50) {
+		t.Error("complete page reported as truncated")
+	}
+}
+
+// TestParseListingDuplicateLinks checks that a row linking its edikt twice counts once,
+// so a page with fewer hits than the portal reports is still seen as truncated.
+func TestParseListingDuplicateLinks(t *testing.T) {
+	l := parseListingHTML(t, `<p>Treffer 1 - 2 von 3</p><table>
+		<tr><td><a href="alldoc/1!OpenDocument"></a>BG Linz</td><td><a href="alldoc/1!OpenDocument">4020 Linz</a></td></tr>
+		<tr><td><a href="alldoc/2!OpenDocument">BG Wels</a></td><td><a href="alldoc/2!OpenDocument">4600 Wels</a></td></tr>
+		</table>`)
+	if len(l.Entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(l.Entries))
+	}
+	if l.Entries[0].Objekt != "4020 Linz" || l.Entries[1].Objekt != "BG Wels" {
+		t.Errorf("Objekt = %q, %q; want the first non-empty link text", l.Entries[0].Objekt, l.Entries[1].Objekt)
+	}
+	if !l.truncated(50) {
+		t.Error("2 of 3 hits not reported as truncated")
+	}
+}
+
+func TestFindCategory(t *testing.T) {
+	tests := []struct {
+		text string
+		want Category
+	}{
+		{"Unbebaute Liegenschaft", CategoryUnbebaut},
+		{"Baugrund (UL)", CategoryUnbebaut},
+		{"(UL) Unbebaute Liegenschaft (UL)", CategoryUnbebaut},
+		{"Einfamilienhaus (EH), im Baurecht", CategoryEinfamilienhaus}, // a code beats labels
+		{"Einfamilienhaus, Zweifamilienhaus", ""},
+		{"Eigentumswohnung (EW), Garage (WE)", ""},
+		{"Wohnung (XX)", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := findCategory(tt.text); got != tt.want {
+			t.Errorf("findCategory(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseTotal(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"123 Treffer", 123},
+		{"Treffer: 45", 45},
+		{"Treffer 1 - 50 von 230", 230},
+		{"Treffer 1–50 von 230", 230},
+		{"Wohnung von 120 m²", -1},
+		{"Seite 1 von 3", -1},
+		{"", -1},
+	}
+	for _, tt := range tests {
+		if got := parseTotal(tt.text); got != tt.want {
+			t.Errorf("parseTotal(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
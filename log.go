@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LogLevel selects which status lines a run prints to stdout.
+// Errors that end the program are always printed to stderr.
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota // every rejected item with its reason
+	LogInfo                  // progress and results: listings, matches, archived documents
+	LogWarn                  // failed items and incomplete results
+	LogError                 // nothing but fatal errors
+)
+
+// logLevelNames are the values of the -log-level flag.
+var logLevelNames = map[string]LogLevel{
+	"debug": LogDebug,
+	"info":  LogInfo,
+	"warn":  LogWarn,
+	"error": LogError,
+}
+
+// logLevel is the current level, set from the -log-level flag.
+var logLevel = LogInfo
+
+// ParseLogLevel parses a -log-level value, case-insensitively.
+func ParseLogLevel(s string) (LogLevel, error) {
+	l, ok := logLevelNames[strings.ToLower(s)]
+	if !ok {
+		return 0, fmt.Errorf("unknown log level %q, want debug, info, warn or error", s)
+	}
+	return l, nil
+}
+
+// logDebug prints a, like fmt.Println, if the level is LogDebug.
+func logDebug(a ...any) {
+	if logLevel <= LogDebug {
+		fmt.Println(a...)
+	}
+}
+
+// logInfo prints a, like fmt.Println, if the level is LogInfo or lower.
+func logInfo(a ...any) {
+	if logLevel <= LogInfo {
+		fmt.Println(a...)
+	}
+}
+
+// logWarn prints a, like fmt.Println, if the level is LogWarn or lower.
+func logWarn(a ...any) {
+	if logLevel <= LogWarn {
+		fmt.Println(a...)
+	}
+}
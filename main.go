@@ -1,85 +1,523 @@
 package main
 
 import (
+	"context"
 	"ediktscraper/email"
+	"ediktscraper/openstreetmap"
 	"fmt"
+	"net/mail"
+	"os"
+	"slices"
 	"strings"
+	"time"
 )
 
-const (
-	// maxCost caps the acceptable "Schätzwert" (appraised value) in EUR.
-	maxCost = 30000
-	// buildableLotUrl lists "UL" category items (buildable lots) in the edikte portal.
-	buildableLotUrl = "https://edikte.justiz.gv.at/edikte/ex/exedi3.nsf/suchedi?SearchView&subf=eex&SearchOrder=4&SearchMax=4999&retfields=~VKat=UL&ftquery=&query=%28%5BVKat%5D%3D%28UL%29%29"
-	// agriForestLandUrl lists "LF" category items (agricultural/forest land) in the edikte portal.
-	agriForestLandUrl = "https://edikte.justiz.gv.at/edikte/ex/exedi3.nsf/suchedi?SearchView&subf=eex&SearchOrder=4&SearchMax=4999&retfields=~VKat=LF&ftquery=&query=%28%5BVKat%5D%3D%28LF%29%29"
-)
+// failure records an item that could not be processed, e.g. a detail page that returned 503.
+type failure struct {
+	URL string
+	Err error
+}
 
-func main() {
+// notification is a match that is part of a mail, recorded in the DB once the mail is sent.
+type notification struct {
+	URL     string
+	Profile string
+}
 
-	// Load persistent database of already-seen edikt "alldoc" URLs.
-	db := LoadDB()
+// match is an item accepted by a profile, with its distance from the profile's home.
+type match struct {
+	it *item
+	km int
+}
 
-	// Collect all edikt "alldoc" URLs from both category search pages.
-	ediktAlldocURLs := CollectEdiktAlldocURLs([]string{buildableLotUrl, agriForestLandUrl})
+// configure applies cfg to the request helpers and makes db the geocode store.
+func configure(cfg *Config, db *DB) {
+	requestLimiter.SetInterval(time.Duration(cfg.Pipeline.HostInterval))
+	requestCache = newHTTPCache(cfg.Cache)
+	requestRetry = cfg.Retry.Policy()
+	openstreetmap.SetRetryPolicy(requestRetry)
+	openstreetmap.SetStore(db)
+}
 
-	// Process each edikt page independently.
-	var body string
-	for _, ediktAlldocURL := range ediktAlldocURLs {
-		// Fetch the edikt page and parse it into a document.
-		// base is the resolved base URL used for converting relative links to absolute.
-		doc, _, base := RequestPage(ediktAlldocURL)
+// readOnlyGeocodes is a geocode store that reads from the DB and never writes, for dry runs and explain.
+type readOnlyGeocodes struct{ *DB }
 
-		// Extract structured fields from the document.
-		edikt := ParseEdikt(doc)
+// SaveGeocode implements openstreetmap.Store and discards p.
+func (readOnlyGeocodes) SaveGeocode(string, openstreetmap.Point) error {
+	return nil
+}
 
-		// -------------------------------------------------------------------------------------
+// run executes the pipeline described in pipeline.go for all enabled profiles.
+// A dry run fetches and filters like a real one, but prints the mails instead of sending
+// them and writes neither to the DB nor to the archive.
+func run(ctx context.Context, cfg *Config, db *DB, dry bool) error {
+	if dry {
+		openstreetmap.SetStore(readOnlyGeocodes{db})
+	}
+	pc := cfg.Pipeline
+	stats := &runStats{Started: time.Now()}
 
-		// Validate entry: require positive appraised value and at least one long-appraisal link.
-		sw := edikt.Schaetzwert()
-		if sw <= 0 || len(edikt.LanggutachtenLinks(base)) == 0 {
-			fmt.Println("Canceled", sw, "eur")
+	// Only enabled profiles take part in the run.
+	var profiles []Profile
+	for _, profile := range cfg.Profiles {
+		if profile.Disabled {
+			logInfo("Disabled profile", profile.Name)
 			continue
 		}
+		profiles = append(profiles, profile)
+	}
+	stats.Profiles = len(profiles)
+
+	// Stage 1: listing.
+	items, searchErrs := collectItems(ctx, profiles, pc.ListingWorkers)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Incremental scraping: only new or stale items are fetched again.
+	// Notified edikte are fetched on every run to report their changes.
+	now := time.Now()
+	trackedURLs, err := db.Tracked(now)
+	if err != nil {
+		return err
+	}
+	tracked := make(map[string]bool, len(trackedURLs))
+	for _, u := range trackedURLs {
+		tracked[u] = true
+	}
+	listed := len(items)
+	items = dropFresh(items, db, time.Duration(pc.Refresh), now, tracked)
+	logInfo("Listed", listed, "edikte,", listed-len(items), "known and fresh,", len(items), "to fetch")
+	items = addTracked(items, trackedURLs)
+	logInfo("Tracking", len(trackedURLs), "notified edikte")
+	stats.Listed, stats.Fetched = listed, len(items)
+
+	// Stage 2: detail fetch.
+	fetchDetails(ctx, items, pc.DetailWorkers)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Stage 3: enrichment. Only enrich items that at least one profile may accept;
+	// the profile homes are geocoded once each.
+	enrichItems(ctx, items, pc.EnrichWorkers, func(it *item) bool {
+		return needsEnrichment(profiles, it)
+	})
+	homes := make([]openstreetmap.Point, len(profiles))
+	homeErrs := make([]error, len(profiles))
+	for pi, profile := range profiles {
+		homes[pi], homeErrs[pi] = openstreetmap.Geocode(ctx, profile.Home)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Compare tracked items with their last snapshot before it is replaced below.
+	// Edikte that are gone are no longer tracked.
+	changes, err := collectChanges(items, db)
+	if err != nil {
+		return err
+	}
+	for _, c := range changes {
+		if c.Rec == nil && !dry {
+			if err := db.MarkGone(c.URL, now); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Stage 4: filter.
+	matches, failures := filterItems(profiles, items, homes, homeErrs, searchErrs)
+
+	// Remember every item that made it through the filter, accepted or not,
+	// so it is not fetched again before the refresh interval expires.
+	for _, it := range items {
+		if it.Err == nil && !dry {
+			if err := db.Observe(it.Rec, now); err != nil {
+				return err
+			}
+		}
+	}
 
-		// Enforce budget cap: skip items priced above maxCost.
-		if sw > maxCost {
-			fmt.Println("Expensive", sw, "eur")
+	// Stage 5: notify.
+	if dry {
+		return notify(ctx, profiles, matches, failures, changes, db, nil, cfg.templates, stats, true)
+	}
+	return notify(ctx, profiles, matches, failures, changes, db, newArchive(cfg.Archive), cfg.templates, stats, false)
+}
+
+// needsEnrichment reports whether at least one profile that listed it may accept it.
+// A record without a usable value needs its Kurzgutachten first, which may state the value.
+func needsEnrichment(profiles []Profile, it *item) bool {
+	if it.Rec.Schaetzwert <= 0 && it.Rec.Kurzgutachten == nil && it.Rec.KurzgutachtenLink != "" {
+		return true
+	}
+	if _, ok := checkRecord(it.Rec); !ok {
+		return false
+	}
+	for _, pi := range it.Profiles {
+		if _, ok := profiles[pi].Check(it.Rec); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRecord decides whether rec can be offered at all, independent of any profile.
+// It returns a short reason and false for auctions that will not take place and for
+// records without a usable appraised value or long appraisal.
+func checkRecord(rec *EdiktRecord) (reason string, ok bool) {
+	switch {
+	case rec.Status == StatusAbberaumt:
+		return "Withdrawn", false
+	case rec.Status == StatusZuschlag:
+		return "Sold", false
+	case rec.Schaetzwert == 0:
+		return "NoValue", false
+	case rec.Schaetzwert < 0:
+		return "BadValue", false
+	case len(rec.LanggutachtenLinks) == 0:
+		return "NoGutachten", false
+	}
+	return "", true
+}
+
+// filterItems applies every profile's limits to the items it listed.
+// It returns the accepted items and the failures per profile, both in item order.
+func filterItems(profiles []Profile, items []*item, homes []openstreetmap.Point, homeErrs, searchErrs []error) ([][]match, [][]failure) {
+	matches := make([][]match, len(profiles))
+	failures := make([][]failure, len(profiles))
+
+	// A failed search or home lookup affects the whole profile.
+	for pi, profile := range profiles {
+		if searchErrs[pi] != nil {
+			logWarn("Failed search", searchErrs[pi])
+			failures[pi] = append(failures[pi], failure{URL: "Suche " + profile.Name, Err: searchErrs[pi]})
+		}
+		if homeErrs[pi] != nil {
+			logWarn("Failed home", homeErrs[pi])
+			failures[pi] = append(failures[pi], failure{URL: "Home " + profile.Home, Err: homeErrs[pi]})
+		}
+	}
+
+	for _, it := range items {
+		// Items that are only tracked belong to no profile, see collectChanges.
+		if len(it.Profiles) == 0 {
+			continue
+		}
+
+		// Skip failed items, but report them to every profile that listed them.
+		if it.Err != nil {
+			logWarn("Failed", it.Err)
+			for _, pi := range it.Profiles {
+				failures[pi] = append(failures[pi], failure{URL: it.URL, Err: it.Err})
+			}
+			continue
+		}
+
+		// Skip auctions that will not take place and records that lack value or appraisal.
+		sw := it.Rec.Schaetzwert
+		if reason, ok := checkRecord(it.Rec); !ok {
+			logDebug(reason, it.URL)
 			continue
 		}
 
-		// De-duplicate: skip entries that were already processed earlier.
-		if isKnown := db.AddEdikt(ediktAlldocURL); isKnown {
-			fmt.Println("Known", sw, "eur")
+		for _, pi := range it.Profiles {
+			profile := profiles[pi]
+
+			// Enforce the profile's price and size limits.
+			if reason, ok := profile.Check(it.Rec); !ok {
+				logDebug(reason, sw, "eur")
+				continue
+			}
+
+			// Enforce the profile's distance limit.
+			if homeErrs[pi] != nil || !it.Geocoded {
+				continue
+			}
+			km := int(openstreetmap.DistanceKM(it.Location, homes[pi]))
+			if reason, ok := profile.CheckDistance(km); !ok {
+				logDebug(reason, km, "km")
+				continue
+			}
+
+			// Enforce the profile's rules, now with the distance and the Kurzgutachten.
+			if reason, ok := profile.CheckRules(ruleValues(it.Rec, &km), false); !ok {
+				logDebug(reason, it.URL)
+				continue
+			}
+
+			matches[pi] = append(matches[pi], match{it: it, km: km})
+		}
+	}
+	return matches, failures
+}
+
+// notify de-duplicates the matches against the DB and mails each recipient of a profile
+// the ones it has not got yet, together with the failed items.
+// Changes of tracked edikte go to everyone who was notified about them.
+// The documents of new and changed matches are archived first if arc is not nil; archive
+// failures are reported like failed items and do not hold back the mail.
+// The mails are rendered with tmpl and sent in one SMTP session, each to all recipients
+// with the same content; stats is completed with the counts of this stage.
+// Matches are recorded for each recipient the server accepted, which marks the edikt
+// notified; the others are reported and get the matches again on the next run.
+// A dry notify only reads the DB and prints each mail instead of sending it.
+func notify(ctx context.Context, profiles []Profile, matches [][]match, failures [][]failure, changes []ediktChanges,
+	db *DB, arc *archive, tmpl *mailTemplates, stats *runStats, dry bool) error {
+
+	// The mail config is read once, when it is first needed.
+	var mailCfg *email.MailConfig
+	loadMailConfig := func() (*email.MailConfig, error) {
+		if mailCfg == nil {
+			cfg, err := email.LoadOrInitMailConfig()
+			if err != nil {
+				return nil, err
+			}
+			mailCfg = cfg
+		}
+		return mailCfg, nil
+	}
+
+	// Collect the matches and failures per recipient.
+	// sent lists the matches of each digest, so they can be recorded once the mail went out.
+	var recipients []string
+	digests := make(map[string]*digest)
+	sent := make(map[string][]notification)
+	digestFor := func(to string) *digest {
+		d, ok := digests[to]
+		if !ok {
+			d = new(digest)
+			digests[to] = d
+			recipients = append(recipients, to)
+		}
+		return d
+	}
+	counted := make(map[string]bool)
+	archived := make(map[string]bool)
+	for pi, profile := range profiles {
+		if len(matches[pi]) == 0 && len(failures[pi]) == 0 {
 			continue
 		}
 
-		// -------------------------------------------------------------------------------------
+		// Fall back to the mail config recipients if the profile has none.
+		var tos []string
+		for _, to := range profile.Recipients {
+			tos = append(tos, strings.TrimSpace(to))
+		}
+		if len(tos) == 0 {
+			defaults, err := loadMailConfig()
+			if err != nil {
+				return err
+			}
+			tos = defaults.To
+		}
+
+		for _, m := range matches[pi] {
+			// De-duplicate: a match is new to every recipient that has not got it yet,
+			// so a recipient whose mail failed gets it again on the next run.
+			var news []string
+			var err error
+			for _, to := range tos {
+				var notified bool
+				if notified, err = db.Notified(m.it.URL, to); err != nil {
+					break
+				}
+				if !notified {
+					news = append(news, to)
+				}
+			}
+			if err != nil {
+				logWarn("Failed", err)
+				failures[pi] = append(failures[pi], failure{URL: m.it.URL, Err: err})
+				continue
+			}
+			if len(news) == 0 {
+				logDebug("Known", m.it.Rec.Schaetzwert, "eur")
+				continue
+			}
+			if !counted[m.it.URL] {
+				counted[m.it.URL] = true
+				stats.Matches++
+			}
 
-		// Preview
-		var m string
-		m += fmt.Sprintf("╔═══════════════════════════════════════════════════════════════════════════════════\n")
-		m += fmt.Sprintf("║  Schätzwert:    %d EUR\n", sw)
-		m += fmt.Sprintf("║  Objektgröße:   %d m²\n", edikt.Objektgroesse())
-		m += fmt.Sprintf("║  Grundgröße:    %d m²\n", edikt.Grundstuecksgroesse())
-		m += fmt.Sprintf("║  PlzOrt:        %s\n", edikt.PlzOrt())
-		m += fmt.Sprintf("║  Entfernung:    %d km\n", edikt.Entfernung())
-		m += fmt.Sprintf("║  AllDocLink:    %s\n", ediktAlldocURL)
-		m += fmt.Sprintf("║  Kurzgutachten: %s\n", edikt.KurzgutachtenLink(base))
-		for _, l := range edikt.LanggutachtenLinks(base) {
-			m += fmt.Sprintf("║  Langgutachten: %v\n", l)
+			// Keep a local copy of the appraisals, once per edikt.
+			if arc != nil && !archived[m.it.URL] {
+				archived[m.it.URL] = true
+				docs, err := arc.Save(ctx, m.it.Rec)
+				if err != nil {
+					logWarn("Failed", err)
+					failures[pi] = append(failures[pi], failure{URL: m.it.URL, Err: err})
+				}
+				if len(docs) > 0 {
+					if err := db.SaveDocuments(m.it.URL, docs); err != nil {
+						return err
+					}
+				}
+			}
+
+			c := newCard(profile, m)
+			logInfo(tmpl.preview(c))
+			for _, to := range news {
+				d := digestFor(to)
+				d.Cards = append(d.Cards, c)
+				sent[to] = append(sent[to], notification{URL: m.it.URL, Profile: profile.Name})
+			}
+		}
+
+		if len(failures[pi]) > 0 {
+			for _, to := range tos {
+				d := digestFor(to)
+				d.Failures = append(d.Failures, failures[pi]...)
+			}
 		}
-		m += fmt.Sprintf("╚═══════════════════════════════════════════════════════════════════════════════════\n")
-		fmt.Println(m)
-		body += m
 	}
 
-	// send email
-	if len(body) > 0 {
-		_, _, _, _, tos := email.LoadOrInitMailConfig()
-		for _, to := range strings.Split(tos, ";") {
-			to = strings.TrimSpace(to)
-			email.SendEmail(to, "Edikte: Neuigkeiten des Tages!", body)
+	// Report changes to everyone who got the edikt; the mail config recipients stand in
+	// for edikte notified before recipients were recorded.
+	for _, c := range changes {
+		if arc != nil && c.Rec != nil {
+			docs, err := arc.Save(ctx, c.Rec)
+			if err != nil {
+				logWarn("Failed", err)
+			}
+			if len(docs) > 0 {
+				if err := db.SaveDocuments(c.URL, docs); err != nil {
+					return err
+				}
+			}
+		}
+
+		tos, err := db.Recipients(c.URL)
+		if err != nil {
+			return err
+		}
+		if len(tos) == 0 {
+			defaults, err := loadMailConfig()
+			if err != nil {
+				return err
+			}
+			tos = defaults.To
+		}
+		for _, to := range tos {
+			d := digestFor(strings.TrimSpace(to))
+			d.Changes = append(d.Changes, c)
+		}
+	}
+
+	// Count every failed item once, over all profiles.
+	var all []failure
+	for _, f := range failures {
+		all = append(all, f...)
+	}
+	stats.Failed = len(uniqueFailures(all))
+	stats.Changed = len(changes)
+
+	// Render the digests; recipients of the same mail get it together.
+	var mails []*outgoing
+	for _, to := range recipients {
+		data := &mailData{Recipient: to, digest: *digests[to], Stats: stats}
+		data.Failures = uniqueFailures(data.Failures)
+		subject, body, html, err := tmpl.render(data)
+		if err != nil {
+			return fmt.Errorf("render mail to %s: %w", to, err)
+		}
+		i := slices.IndexFunc(mails, func(m *outgoing) bool {
+			return m.subject == subject && m.body == body && m.html == html
+		})
+		if i < 0 {
+			i = len(mails)
+			mails = append(mails, &outgoing{subject: subject, body: body, html: html})
+		}
+		mails[i].to = append(mails[i].to, to)
+	}
+	if len(mails) == 0 {
+		return nil
+	}
+	if dry {
+		for _, m := range mails {
+			fmt.Printf("Dry run, not sent to %s: %s\n%s\n", strings.Join(m.to, ", "), m.subject, m.body)
+		}
+		return nil
+	}
+
+	// send all mails in one session: the text body with an HTML alternative,
+	// with a copy to the Cc and Bcc addresses of the mail config
+	if _, err := loadMailConfig(); err != nil {
+		return err
+	}
+	session, err := email.Dial(mailCfg)
+	if err != nil {
+		return err
+	}
+	var mailErr error
+	for _, m := range mails {
+		results, err := session.Send(&email.Message{To: m.to, Cc: mailCfg.Cc, Bcc: mailCfg.Bcc,
+			Subject: m.subject, Body: m.body, HTML: m.html})
+		for _, r := range results {
+			if r.Err != nil {
+				fmt.Fprintln(os.Stderr, "Mail to", r.Addr, "failed:", r.Err)
+				mailErr = r.Err
+			} else {
+				logInfo("Mail sent to", r.Addr)
+			}
+		}
+		if err != nil {
+			if results == nil {
+				fmt.Fprintln(os.Stderr, "Mail to", strings.Join(m.to, ", "), "failed:", err)
+			}
+			mailErr = err
+		}
+
+		// Record the matches for each recipient that got the mail; the others get them again next run.
+		now := time.Now()
+		for _, to := range m.to {
+			if !delivered(to, results) {
+				continue
+			}
+			for _, n := range sent[to] {
+				if err := db.AddNotification(n.URL, n.Profile, to, now); err != nil {
+					_ = session.Close()
+					return err
+				}
+			}
+		}
+	}
+	if err := session.Close(); err != nil {
+		logWarn("Warning", err)
+	}
+	return mailErr
+}
+
+// outgoing is a rendered mail and the recipients it goes to.
+type outgoing struct {
+	to                  []string
+	subject, body, html string
+}
+
+// delivered reports whether the server accepted the mail for the address to.
+func delivered(to string, results []email.RecipientResult) bool {
+	a, err := mail.ParseAddress(to)
+	if err != nil {
+		return false
+	}
+	for _, r := range results {
+		if strings.EqualFold(r.Addr, a.Address) {
+			return r.Err == nil
+		}
+	}
+	return false
+}
+
+// uniqueFailures returns the first failure of each URL, in order.
+func uniqueFailures(failures []failure) []failure {
+	seen := make(map[string]bool)
+	var unique []failure
+	for _, f := range failures {
+		if !seen[f.URL] {
+			seen[f.URL] = true
+			unique = append(unique, f)
 		}
 	}
+	return unique
 }
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestNeedsEnrichment(t *testing.T) {
+	profiles := []Profile{{Name: "billig", MaxPrice: 30000}}
+	links := []string{"https://example.com/lg.pdf"}
+	tests := []struct {
+		name string
+		rec  EdiktRecord
+		want bool
+	}{
+		{"cheap", EdiktRecord{Schaetzwert: 20000, LanggutachtenLinks: links}, true},
+		{"expensive", EdiktRecord{Schaetzwert: 90000, LanggutachtenLinks: links}, false},
+		{"value from the Kurzgutachten", EdiktRecord{KurzgutachtenLink: "kg", LanggutachtenLinks: links}, true},
+		{"no value, no Kurzgutachten", EdiktRecord{LanggutachtenLinks: links}, false},
+		{"no value after the Kurzgutachten", EdiktRecord{KurzgutachtenLink: "kg", Kurzgutachten: map[string][]string{},
+			LanggutachtenLinks: links}, false},
+		{"expensive after the Kurzgutachten", EdiktRecord{Schaetzwert: 90000, KurzgutachtenLink: "kg",
+			Kurzgutachten: map[string][]string{}, LanggutachtenLinks: links}, false},
+	}
+	for _, tt := range tests {
+		it := &item{Rec: &tt.rec, Profiles: []int{0}}
+		if got := needsEnrichment(profiles, it); got != tt.want {
+			t.Errorf("%s: needsEnrichment = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
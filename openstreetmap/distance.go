@@ -6,7 +6,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"math"
 	"net/http"
 	"net/url"
@@ -14,6 +13,29 @@ import (
 	"time"
 )
 
+// NotFoundError is returned if Nominatim has no result for a query.
+type NotFoundError struct {
+	Query string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("no geocoding result for %q", e.Query)
+}
+
+// StatusError is returned if Nominatim answers with a non-200 status,
+// e.g. 429 (Too Many Requests) when rate limited, or 5xx on server error.
+type StatusError struct {
+	StatusCode int    // e.g. 429
+	Status     string // e.g. "429 Too Many Requests"
+}
+
+func (e *StatusError) Error() string {
+	return "geocoding failed: " + e.Status
+}
+
+// client bounds the lifetime of a single Nominatim request.
+var client = &http.Client{Timeout: 8 * time.Second}
+
 // GeocodeResult maps the minimal fields we need from Nominatim.
 // The Nominatim "search" endpoint returns an array; we need only the first
 // element's "lat" and "lon" fields. They are strings in the payload and must
@@ -30,9 +52,11 @@ type geocodeResult []struct {
 //   - Applies a context (deadline/timeout) from the caller.
 //   - Sets a custom User-Agent per Nominatim usage policy. Requests without a
 //     valid UA may be throttled or rejected.
-//   - Exits the process on network/HTTP/JSON errors via log.Fatal.
+//   - Retries transient failures according to retryPolicy.
+//   - Returns network/JSON errors as-is, a *StatusError for non-200 responses
+//     and a *NotFoundError if there is no match.
 //   - Returns the first match's latitude and longitude as float64.
-func geocode(ctx context.Context, query string) (float64, float64) {
+func geocode(ctx context.Context, query string) (lat, lon float64, err error) {
 	// Build request URL for the "search" endpoint.
 	u, _ := url.Parse("https://nominatim.openstreetmap.org/search")
 	q := u.Query()
@@ -45,48 +69,55 @@ func geocode(ctx context.Context, query string) (float64, float64) {
 
 	// Prepare HTTP request with context. Context ensures the request will be
 	// cancelled when the deadline is exceeded or the caller cancels.
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, 0, err
+	}
 
 	// Set a descriptive User-Agent as required by Nominatim policy.
 	// Replace contact@example.com with a real contact address for production use.
 	req.Header.Set("User-Agent", "plz-distance-tool/1.0 (contact@example.com)")
 
-	// Execute the request using the default client. For production, consider a
-	// custom http.Client with tuned Transport (connection pooling, timeouts).
-	resp, err := http.DefaultClient.Do(req)
+	// Execute the request with the retry policy. Each attempt waits for its own
+	// rate limit slot and is bounded by the client timeout.
+	resp, err := retryPolicy.Do(ctx, func(ctx context.Context) (*http.Response, error) {
+		if err := waitSlot(ctx); err != nil {
+			return nil, err
+		}
+		return client.Do(req.Clone(ctx))
+	})
 	if err != nil {
-		// Network error, DNS failure, context timeout, etc. Fail fast.
-		log.Fatal(err)
+		// Network error, DNS failure, context timeout, etc.
+		return 0, 0, err
 	}
 	defer resp.Body.Close()
 
-	// Validate successful HTTP status. Nominatim may return 429 (Too Many Requests)
-	// when rate limited, or 5xx on server error. We fail fast here.
+	// Validate successful HTTP status.
 	if resp.StatusCode != http.StatusOK {
-		log.Fatalf("geocoding failed: %s", resp.Status)
+		return 0, 0, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	// Decode JSON array response into our minimal struct.
 	var res geocodeResult
 	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
-		log.Fatal(err)
+		return 0, 0, fmt.Errorf("decode geocoding result for %q: %w", query, err)
 	}
 	if len(res) == 0 {
-		// No candidates found for the query; fail fast to surface the issue.
-		log.Fatalf("no geocoding result for %q", query)
+		// No candidates found for the query.
+		return 0, 0, &NotFoundError{Query: query}
 	}
 
 	// Parse coordinate strings to float64. If parsing fails, the payload was invalid
-	// or unexpected; fail fast to avoid propagating bad data downstream.
-	lat, err := strconv.ParseFloat(res[0].Lat, 64)
+	// or unexpected; report it to avoid propagating bad data downstream.
+	lat, err = strconv.ParseFloat(res[0].Lat, 64)
 	if err != nil {
-		log.Fatal(err)
+		return 0, 0, err
 	}
-	lon, err := strconv.ParseFloat(res[0].Lon, 64)
+	lon, err = strconv.ParseFloat(res[0].Lon, 64)
 	if err != nil {
-		log.Fatal(err)
+		return 0, 0, err
 	}
-	return lat, lon
+	return lat, lon, nil
 }
 
 // haversineKM computes great-circle distance in kilometers between two WGS84
@@ -124,27 +155,3 @@ func haversineKM(lat1, lon1, lat2, lon2 float64) float64 {
 	const R = 6371.0
 	return R * c
 }
-
-// Distance returns the integer distance in kilometers between an input Austrian
-// postal code (ZIP) and the fixed destination "4020 Linz, Austria".
-func Distance(zip string) int {
-	// Build source query by pairing the ZIP with the country for better disambiguation.
-	src := fmt.Sprintf("%s, Austria", zip)
-
-	// Fixed destination for this tool: postal district 4020 in Linz, Austria.
-	dst := "4020 Linz, Austria"
-
-	// Bound the lifetime of both HTTP requests to Nominatim.
-	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
-	defer cancel()
-
-	// Geocode source and destination to WGS84 coordinates.
-	lat1, lon1 := geocode(ctx, src)
-	lat2, lon2 := geocode(ctx, dst)
-
-	// Compute great-circle distance between the two points.
-	km := haversineKM(lat1, lon1, lat2, lon2)
-
-	// Return the truncated integer number of kilometers.
-	return int(km)
-}
@@ -0,0 +1,126 @@
+package openstreetmap
+
+import (
+	"context"
+	"ediktscraper/retry"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Point is a WGS84 coordinate in decimal degrees.
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+// minInterval is the minimum delay between two Nominatim requests.
+// The Nominatim usage policy allows at most 1 request per second.
+const minInterval = time.Second
+
+var (
+	// retryPolicy is applied to every Nominatim request, see SetRetryPolicy.
+	retryPolicy = retry.Default
+
+	// limitMu serializes requests and guards nextSlot.
+	limitMu  sync.Mutex
+	nextSlot time.Time
+
+	// cacheMu guards cache, the in-memory memo of successful lookups by query.
+	cacheMu sync.Mutex
+	cache   = make(map[string]Point)
+
+	// store persists successful lookups across runs, see SetStore; nil keeps them in memory only.
+	store Store
+)
+
+// Store persists geocoding results by query, e.g. "4020 Linz, Austria".
+// Implementations must be safe for concurrent use.
+type Store interface {
+	LookupGeocode(query string) (p Point, ok bool)
+	SaveGeocode(query string, p Point) error
+}
+
+// Geocode returns the coordinates for a free-text Austrian location, e.g. "4020 Linz".
+// It is safe for concurrent use: results are memoized per query (and persisted if a
+// Store is set), and requests to Nominatim (including retries) are spaced at least
+// minInterval apart regardless of the number of callers. Waiting for a slot honours
+// ctx cancellation.
+func Geocode(ctx context.Context, location string) (Point, error) {
+	// Pair the location with the country for better disambiguation.
+	query := fmt.Sprintf("%s, Austria", location)
+
+	// Serve repeated queries (same PLZ, same home) from memory.
+	cacheMu.Lock()
+	p, ok := cache[query]
+	cacheMu.Unlock()
+	if ok {
+		return p, nil
+	}
+
+	// Then from earlier runs, without asking Nominatim at all.
+	if store != nil {
+		if p, ok := store.LookupGeocode(query); ok {
+			remember(query, p)
+			return p, nil
+		}
+	}
+
+	lat, lon, err := geocode(ctx, query)
+	if err != nil {
+		return Point{}, err
+	}
+	p = Point{Lat: lat, Lon: lon}
+
+	// A failing store only costs a lookup in the next run.
+	remember(query, p)
+	if store != nil {
+		_ = store.SaveGeocode(query, p)
+	}
+	return p, nil
+}
+
+// remember adds p to the in-memory memo.
+func remember(query string, p Point) {
+	cacheMu.Lock()
+	cache[query] = p
+	cacheMu.Unlock()
+}
+
+// SetStore sets the persistent store for geocoding results; nil disables it.
+// It is not safe to call concurrently with Geocode.
+func SetStore(s Store) {
+	store = s
+}
+
+// SetRetryPolicy changes the retry policy for Nominatim requests.
+// It is not safe to call concurrently with Geocode.
+func SetRetryPolicy(p retry.Policy) {
+	retryPolicy = p
+}
+
+// waitSlot reserves the next request slot and sleeps until it starts.
+func waitSlot(ctx context.Context) error {
+	limitMu.Lock()
+	now := time.Now()
+	slot := nextSlot
+	if slot.Before(now) {
+		slot = now
+	}
+	nextSlot = slot.Add(minInterval)
+	limitMu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// DistanceKM returns the great-circle distance in kilometers between two points.
+func DistanceKM(a, b Point) float64 {
+	return haversineKM(a.Lat, a.Lon, b.Lat, b.Lon)
+}
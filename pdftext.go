@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// pdfMagic is the header every PDF file starts with.
+var pdfMagic = []byte("%PDF-")
+
+// isPDF reports whether the file at path starts with the PDF header.
+// The portal serves appraisals as application/octet-stream too, so the content type is not reliable.
+func isPDF(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	head := make([]byte, len(pdfMagic))
+	if _, err := io.ReadFull(f, head); err != nil {
+		return false
+	}
+	return bytes.Equal(head, pdfMagic)
+}
+
+// ExtractPDFText returns the text of the PDF file at path, normalized by CleanText.
+// Pages are separated by an empty line. Scanned documents without a text layer
+// yield an empty string. Malformed files return an error instead of panicking.
+func ExtractPDFText(path string) (text string, err error) {
+	// The PDF reader reports malformed input by panicking.
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = "", fmt.Errorf("pdf %s: %v", path, r)
+		}
+	}()
+
+	f, r, err := pdf.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("pdf %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var pages []string
+	for i := 1; i <= r.NumPage(); i++ {
+		// Font names like "F1" are local to the page and often name different fonts on
+		// other pages, so every page decodes with its own.
+		p := r.Page(i)
+		fonts := make(map[string]*pdf.Font)
+		for _, name := range p.Fonts() {
+			font := p.Font(name)
+			fonts[name] = &font
+		}
+		s, err := p.GetPlainText(fonts)
+		if err != nil {
+			return "", fmt.Errorf("pdf %s: page %d: %w", path, i, err)
+		}
+		pages = append(pages, s)
+	}
+
+	return CleanText(strings.Join(pages, "\n\n")), nil
+}
+
+// textFileName returns the name of the text file stored next to a document, e.g. "Gutachten.txt" for "Gutachten.pdf".
+func textFileName(file string) string {
+	return strings.TrimSuffix(file, filepath.Ext(file)) + ".txt"
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestExtractPDFTextFonts checks that each page decodes with its own fonts:
+// both pages of the fixture name their font "F1", with different encodings.
+func TestExtractPDFTextFonts(t *testing.T) {
+	text, err := ExtractPDFText(filepath.Join("testdata", "two_fonts.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Hallo\n\nWelt"; text != want {
+		t.Errorf("text = %q, want %q", text, want)
+	}
+}
+
+func TestExtractPDFTextMalformed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.pdf")
+	if err := os.WriteFile(path, []byte("%PDF-1.4\nnot really a pdf"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExtractPDFText(path); err == nil {
+		t.Error("malformed PDF: no error")
+	}
+}
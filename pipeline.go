@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"ediktscraper/openstreetmap"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A run is a staged pipeline:
+//
+//	listing  -> search result pages of all enabled profiles, pre-filtered by Profile.MatchListing
+//	            and de-duplicated into items
+//	known    -> drop items whose detail page was fetched recently (see DB.NeedsFetch),
+//	            except tracked ones, and add the tracked edikte the searches no longer list
+//	detail   -> download and parse each item's detail page
+//	enrich   -> parse the Kurzgutachten and geocode the PLZ/Ort of items that a profile may accept
+//	changes  -> compare tracked items with their last snapshot (see collectChanges)
+//	filter   -> apply each profile's limits (see filterItems in main.go)
+//	notify   -> de-duplicate against the DB, archive the documents of new matches and send the mails
+//
+// Every stage writes its results by index into a slice allocated up front,
+// so the output order only depends on the search results and never on scheduling.
+
+// item is one edikt flowing through the pipeline.
+type item struct {
+	URL      string              // absolute "alldoc" URL
+	Entry    ListingEntry        // summary from the first search result row that listed the item
+	Profiles []int               // indices of the profiles whose searches listed and pre-accepted the item
+	Tracked  bool                // notified earlier and still active; changes are reported (see DB.Tracked)
+	Rec      *EdiktRecord        // parsed detail page, set by fetchDetails
+	Location openstreetmap.Point // geocoded PLZ/Ort, set by enrichItems
+	Geocoded bool                // Location is valid
+	Err      error               // first error of any stage; the item is skipped afterwards
+}
+
+// parallel calls fn(ctx, i) for every i in [0, n) using at most workers goroutines.
+// Once ctx is cancelled no new calls are started; parallel returns when all started calls are done.
+func parallel(ctx context.Context, n, workers int, fn func(ctx context.Context, i int)) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	// Feed indices to the workers until all are handed out or ctx is cancelled.
+	indices := make(chan int)
+	go func() {
+		defer close(indices)
+		for i := 0; i < n; i++ {
+			select {
+			case <-ctx.Done():
+				return
+			case indices <- i:
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				fn(ctx, i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// collectItems runs the searches of all profiles and merges their results into one item list.
+// Result rows rejected by Profile.MatchListing are dropped; an edikt listed by several
+// profiles becomes a single item that references all of them.
+// Failed searches are returned per profile index.
+func collectItems(ctx context.Context, profiles []Profile, workers int) (items []*item, searchErrs []error) {
+	searchErrs = make([]error, len(profiles))
+	byURL := make(map[string]*item)
+
+	for pi, profile := range profiles {
+		listings, err := CollectListings(ctx, profile.Queries(), workers)
+		searchErrs[pi] = err
+
+		for _, listing := range listings {
+			logInfo("Listing", profile.Name, len(listing.Entries), "of", listing.Total, "hits")
+
+			for _, entry := range listing.Entries {
+				// Pre-filter on the row summary, before any detail page is fetched.
+				if reason, ok := profile.MatchListing(entry); !ok {
+					logDebug(reason, entry.Objekt)
+					continue
+				}
+
+				it, ok := byURL[entry.URL]
+				if !ok {
+					it = &item{URL: entry.URL, Entry: entry}
+					byURL[entry.URL] = it
+					items = append(items, it)
+				}
+				// Search results may contain duplicates; reference each profile only once.
+				if n := len(it.Profiles); n == 0 || it.Profiles[n-1] != pi {
+					it.Profiles = append(it.Profiles, pi)
+				}
+			}
+		}
+	}
+	return items, searchErrs
+}
+
+// dropFresh returns the items whose detail page has to be fetched: new URLs, known URLs
+// whose last fetch is older than refresh and tracked URLs. The order is preserved.
+func dropFresh(items []*item, db *DB, refresh time.Duration, now time.Time, tracked map[string]bool) []*item {
+	kept := make([]*item, 0, len(items))
+	for _, it := range items {
+		it.Tracked = tracked[it.URL]
+		if it.Tracked || db.NeedsFetch(it.URL, refresh, now) {
+			kept = append(kept, it)
+		}
+	}
+	return kept
+}
+
+// addTracked appends an item for every tracked URL the searches did not list,
+// e.g. because its category changed or it was withdrawn. Such items belong to no profile
+// and only take part in change tracking.
+func addTracked(items []*item, tracked []string) []*item {
+	listed := make(map[string]bool, len(items))
+	for _, it := range items {
+		listed[it.URL] = true
+	}
+	for _, u := range tracked {
+		if !listed[u] {
+			items = append(items, &item{URL: u, Tracked: true})
+		}
+	}
+	return items
+}
+
+// fetchDetails downloads and parses the detail page of every item.
+func fetchDetails(ctx context.Context, items []*item, workers int) {
+	parallel(ctx, len(items), workers, func(ctx context.Context, i int) {
+		it := items[i]
+
+		// Fetch the edikt page and parse it into a document.
+		// base is the resolved base URL used for converting relative links to absolute.
+		doc, _, base, err := RequestPage(ctx, it.URL)
+		if err != nil {
+			it.Err = err
+			return
+		}
+
+		// Extract structured fields from the document. The record is keyed by the listed URL.
+		_, it.Rec = ParseEdikt(doc, base)
+		it.Rec.URL = it.URL
+	})
+}
+
+// enrichItems merges the Kurzgutachten into the record and geocodes the PLZ/Ort
+// of every item for which need returns true, before and again after the Kurzgutachten.
+// openstreetmap.Geocode memoizes and rate limits, so workers mostly overlap waiting.
+// A failed Kurzgutachten only costs its fields and is reported as a warning.
+func enrichItems(ctx context.Context, items []*item, workers int, need func(it *item) bool) {
+	parallel(ctx, len(items), workers, func(ctx context.Context, i int) {
+		it := items[i]
+		if it.Err != nil || !need(it) {
+			return
+		}
+
+		if err := FetchKurzgutachten(ctx, it.Rec); err != nil {
+			logWarn("Warning: kurzgutachten", it.URL, err)
+		}
+
+		// The Kurzgutachten may have filled in the value or size, so decide again before geocoding.
+		if !need(it) {
+			return
+		}
+
+		p, err := openstreetmap.Geocode(ctx, it.Rec.PlzOrt)
+		if err != nil {
+			it.Err = fmt.Errorf("geocode %q: %w", it.Rec.PlzOrt, err)
+			return
+		}
+		it.Location, it.Geocoded = p, true
+	})
+}
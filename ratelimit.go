@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// hostLimiter spaces requests to the same host at least interval apart.
+// It is safe for concurrent use; callers to different hosts do not wait for each other.
+type hostLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     map[string]time.Time // next free request slot per host
+}
+
+// requestLimiter is used by Request for every outgoing request.
+// The interval is set from the config by main; zero disables limiting.
+var requestLimiter = &hostLimiter{next: make(map[string]time.Time)}
+
+// SetInterval changes the minimum delay between two requests to the same host.
+func (l *hostLimiter) SetInterval(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.interval = d
+}
+
+// Wait reserves the next request slot for host and blocks until it starts
+// or ctx is cancelled.
+func (l *hostLimiter) Wait(ctx context.Context, host string) error {
+	l.mu.Lock()
+	if l.interval <= 0 {
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+	now := time.Now()
+	slot := l.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next[host] = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
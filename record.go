@@ -0,0 +1,188 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// EdiktRecord is a typed, serializable snapshot of one edikt detail page.
+// Unlike Edikt it does not reference the DOM, so it stays valid after the
+// document is gone and round-trips through encoding/json.
+//
+// Numeric fields follow the Edikt.GetInt convention: 0 means "not shown on the page",
+// -1 means "shown but not parseable".
+type EdiktRecord struct {
+	URL                  string            `json:"url"`                            // absolute "alldoc" URL of the detail page
+	Dienststelle         string            `json:"dienststelle,omitempty"`         // court handling the case, e.g. "BG Linz"
+	Aktenzeichen         string            `json:"aktenzeichen,omitempty"`         // case number, e.g. "12 E 34/25x"
+	Kategorie            string            `json:"kategorie,omitempty"`            // object category as shown on the page
+	Status               Status            `json:"status,omitempty"`               // auction status, see ParseStatus
+	Versteigerungstermin time.Time         `json:"versteigerungstermin,omitzero"`  // auction date and time (Europe/Vienna)
+	Schaetzwert          int               `json:"schaetzwert"`                    // appraised value in EUR
+	GeringstesGebot      int               `json:"geringstes_gebot"`               // lowest admissible bid in EUR
+	Vadium               int               `json:"vadium"`                         // security deposit in EUR
+	Objektgroesse        int               `json:"objektgroesse"`                  // object size in m²
+	Grundstuecksgroesse  int               `json:"grundstuecksgroesse"`            // lot size in m²
+	PlzOrt               string            `json:"plz_ort,omitempty"`              // postal code and town, e.g. "4020 Linz"
+	Liegenschaftsadresse string            `json:"liegenschaftsadresse,omitempty"` // street address of the property
+	Grundbuch            string            `json:"grundbuch,omitempty"`            // cadastral community
+	EZ                   string            `json:"ez,omitempty"`                   // land register entry number
+	Grundstuecksnr       string            `json:"grundstuecksnr,omitempty"`       // parcel number(s)
+	KurzgutachtenLink    string            `json:"kurzgutachten_link,omitempty"`   // absolute URL of the short appraisal
+	LanggutachtenLinks   []string          `json:"langgutachten_links,omitempty"`  // absolute URLs of the long appraisal files
+	Felder               map[string]string `json:"felder,omitempty"`               // every label on the page with its plain text value
+
+	// Set by MergeKurzgutachten from the short appraisal.
+	Stichtag      time.Time           `json:"stichtag,omitzero"`       // valuation date of the appraisal (Europe/Vienna)
+	Zubehoerwert  int                 `json:"zubehoerwert"`            // value of the accessories auctioned with the property in EUR
+	Kurzgutachten map[string][]string `json:"kurzgutachten,omitempty"` // every field of the short appraisal, see Kurzgutachten.Fields
+}
+
+// NewEdiktRecord converts a parsed Edikt into an EdiktRecord.
+// baseURL is used to resolve document links and is the initial EdiktRecord.URL; callers that
+// know the requested "alldoc" URL (which differs from the base after redirects or a <base href>)
+// overwrite URL with it.
+// Labels that differ between page variants are looked up under all known spellings.
+func NewEdiktRecord(e Edikt, baseURL *url.URL) *EdiktRecord {
+	rec := &EdiktRecord{
+		URL:                  baseURL.String(),
+		Dienststelle:         e.firstTxt("Dienststelle"),
+		Aktenzeichen:         e.firstTxt("Aktenzeichen"),
+		Kategorie:            e.firstTxt("Kategorie(n)", "Kategorie"),
+		Versteigerungstermin: parseTermin(e.firstTxt("Versteigerungstermin", "Termin")),
+		Schaetzwert:          e.Schaetzwert(),
+		GeringstesGebot:      e.firstInt("Geringstes Gebot"),
+		Vadium:               e.firstInt("Vadium"),
+		Objektgroesse:        e.Objektgroesse(),
+		Grundstuecksgroesse:  e.Grundstuecksgroesse(),
+		PlzOrt:               e.PlzOrt(),
+		Liegenschaftsadresse: e.Liegenschaftsadresse(),
+		Grundbuch:            e.firstTxt("Grundbuch"),
+		EZ:                   e.firstTxt("EZ"),
+		Grundstuecksnr:       e.firstTxt("Grundstücksnr.", "Grundstücksnr"),
+		LanggutachtenLinks:   e.LanggutachtenLinks(baseURL),
+		Felder:               make(map[string]string, len(e)),
+	}
+
+	// Take the first Kurzgutachten link; edikte with several are rare.
+	if links := e.GetLinks("Kurzgutachten", baseURL); len(links) > 0 {
+		rec.KurzgutachtenLink = links[0]
+	}
+
+	// Keep every non-empty label, so fields without a dedicated struct member are not lost.
+	for key := range e {
+		if key == "" {
+			continue
+		}
+		if value := e.GetTxt(key); value != "" {
+			rec.Felder[key] = value
+		}
+	}
+
+	return rec
+}
+
+// MergeKurzgutachten adds the fields of the short appraisal to the record.
+// Stichtag and Zubehoerwert are taken from k; fields the detail page left empty are
+// filled from k, values shown on the detail page are kept.
+func (r *EdiktRecord) MergeKurzgutachten(k *Kurzgutachten) {
+	r.Kurzgutachten = k.Fields
+	r.Stichtag = k.Stichtag()
+	r.Zubehoerwert = k.Zubehoerwert()
+
+	// Fill gaps of the detail page. Repeated labels (e.g. several parcels) are joined.
+	fill := func(field *string, label string) {
+		if *field == "" {
+			*field = strings.Join(k.Fields[label], ", ")
+		}
+	}
+	fill(&r.Aktenzeichen, "Aktenzeichen")
+	fill(&r.Grundbuch, "Grundbuch")
+	fill(&r.EZ, "EZ")
+	fill(&r.Grundstuecksnr, "Grundstücksnr.")
+	fill(&r.PlzOrt, "PLZ/Ort")
+	fill(&r.Liegenschaftsadresse, "Adresse")
+	if r.Schaetzwert <= 0 {
+		r.Schaetzwert = parseEuro(k.Get("Schätzwert"))
+	}
+	if r.Grundstuecksgroesse <= 0 {
+		r.Grundstuecksgroesse = parseInt(k.Get("Grundstücksgröße"))
+	}
+}
+
+// ID returns a short, file-system safe identifier of the edikt: the document ID of its
+// "alldoc" URL (".../alldoc/<id>!OpenDocument"), or a hash of the URL for other formats.
+func (r *EdiktRecord) ID() string {
+	return ediktID(r.URL)
+}
+
+// reEdiktID matches the document ID of an "alldoc" URL.
+var reEdiktID = regexp.MustCompile(`(?i)/alldoc/([0-9a-z]+)`)
+
+// ediktID implements EdiktRecord.ID for an "alldoc" URL.
+func ediktID(link string) string {
+	if m := reEdiktID.FindStringSubmatch(link); m != nil {
+		return strings.ToLower(m[1])
+	}
+	sum := sha256.Sum256([]byte(link))
+	return hex.EncodeToString(sum[:16])
+}
+
+// firstTxt returns the text of the first key that has a non-empty value.
+func (e Edikt) firstTxt(keys ...string) string {
+	for _, key := range keys {
+		if value := e.GetTxt(key); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// firstInt returns the integer value of the first key that has a non-empty value.
+// See GetInt for parsing behavior.
+func (e Edikt) firstInt(keys ...string) int {
+	for _, key := range keys {
+		if e.GetTxt(key) != "" {
+			return e.GetInt(key)
+		}
+	}
+	return 0
+}
+
+// reTermin matches "DD.MM.YYYY" with an optional "HH:MM" time, e.g. "12.11.2025 um 09:30 Uhr".
+var reTermin = regexp.MustCompile(`(\d{1,2}\.\d{1,2}\.\d{4})(?:\D+(\d{1,2}:\d{2}))?`)
+
+// parseTermin extracts the auction date from free text.
+// Returns the zero time if no date is found.
+func parseTermin(s string) time.Time {
+	m := reTermin.FindStringSubmatch(s)
+	if m == nil {
+		return time.Time{}
+	}
+
+	// Default to midnight when the page only shows the date.
+	value, layout := m[1], "2.1.2006"
+	if m[2] != "" {
+		value, layout = m[1]+" "+m[2], "2.1.2006 15:04"
+	}
+
+	t, err := time.ParseInLocation(layout, value, viennaLocation())
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// viennaLocation returns the portal's time zone, falling back to local time
+// if the zoneinfo database is not available.
+func viennaLocation() *time.Location {
+	loc, err := time.LoadLocation("Europe/Vienna")
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
@@ -3,91 +3,215 @@ package main
 import (
 	"bytes"
 	"context"
+	"ediktscraper/retry"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html/charset"
 )
 
+// requestRetry is the retry policy of Request. It is set from the config by main.
+var requestRetry = retry.Default
+
+// maxResponseBytes bounds the body Request buffers in memory. Pages are far smaller;
+// documents of any size are downloaded with archive.Save, which streams them to disk.
+const maxResponseBytes = 16 << 20
+
+// response is a downloaded body with the metadata needed to interpret it.
+type response struct {
+	Body        []byte
+	URL         string // final URL after redirects
+	ContentType string // Content-Type header, may be empty
+}
+
 // Request downloads the raw response body for the given URL.
 // It performs an HTTP GET with a context deadline and browser-like headers.
-// Returns the body bytes as-is (HTML, PDF, etc.). On any error, it logs and exits.
-// Only 2xx responses are accepted.
-// No size limit is enforced; large responses will be fully buffered in memory.
-func Request(link string) []byte {
+// Requests to the same host are spaced by requestLimiter; cancelling ctx aborts waiting and downloading.
+// Transient failures are retried according to requestRetry; every attempt waits for its own slot.
+// If requestCache is set, fresh cache entries are returned without a request and stale ones
+// are revalidated with a conditional GET.
+// Returns the body bytes as-is (HTML, PDF, etc.).
+// Only 2xx responses are accepted; other statuses return a *HTTPStatusError.
+// Bodies larger than maxResponseBytes return a *DocumentTooLargeError, since they are
+// buffered in memory. Documents are better downloaded with archive.Save, which streams them to disk.
+func Request(ctx context.Context, link string) ([]byte, error) {
+	resp, err := fetch(ctx, link)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// fetch implements Request and additionally returns the final URL and the content type.
+func fetch(ctx context.Context, link string) (*response, error) {
 
-	// Create a context with a hard deadline so the request cannot hang forever.
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	// Serve from the cache if possible; keep a stale entry for revalidation.
+	var cached []byte
+	var entry *cacheEntry
+	if requestCache != nil {
+		var fresh bool
+		cached, entry, fresh = requestCache.Lookup(link)
+		if fresh {
+			return entry.response(cached), nil
+		}
+	}
 
-	// HTTP client with a sane timeout for connection + response.
+	// HTTP client with a sane timeout for connection + response of a single attempt.
 	client := &http.Client{
 		Timeout: 25 * time.Second,
 	}
 
-	// Build a GET request bound to the context and set pragmatic headers.
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	// Build a GET request bound to the context.
+	req, err := newRequest(ctx, link)
 	if err != nil {
-		panic(err) // Abort immediately on request construction failure.
+		return nil, err
+	}
+
+	// Ask the server to confirm a stale cache entry instead of sending it again.
+	if entry != nil {
+		setConditional(req, entry.ETag, entry.LastModified)
 	}
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:142.0) Gecko/20100101 Firefox/142.0")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "de,en;q=0.8")
 
-	// Execute the HTTP call.
-	resp, err := client.Do(req)
+	// Execute the HTTP call, retrying transient failures.
+	resp, err := send(ctx, client, req)
 	if err != nil {
-		println("link:", link)
-		panic(err) // Abort on transport-level error.
+		return nil, err
 	}
 	defer resp.Body.Close()
 
+	// The cached copy is still valid.
+	if resp.StatusCode == http.StatusNotModified && entry != nil {
+		requestCache.Revalidate(link, entry)
+		return entry.response(cached), nil
+	}
+
 	// Enforce a successful 2xx status.
 	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		panic(resp.Status)
+		return nil, &HTTPStatusError{URL: link, StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	// Read the full body once so we can both parse and return it as text.
-	// If very large pages are expected, consider a size cap.
-	body, err := io.ReadAll(resp.Body)
+	// Reading one byte more than allowed detects oversize bodies without Content-Length.
+	if resp.ContentLength > maxResponseBytes {
+		return nil, &DocumentTooLargeError{URL: link, Limit: maxResponseBytes}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes+1))
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("GET %s: %w", link, err)
+	}
+	if len(body) > maxResponseBytes {
+		return nil, &DocumentTooLargeError{URL: link, Limit: maxResponseBytes}
+	}
+
+	// resp.Request is the last request of the redirect chain.
+	finalURL := resp.Request.URL.String()
+	if requestCache != nil {
+		requestCache.Store(link, finalURL, resp.Header, body)
 	}
 
 	// return (html or pdf)
-	return body
+	return &response{Body: body, URL: finalURL, ContentType: resp.Header.Get("Content-Type")}, nil
+}
+
+// newRequest builds a GET request bound to ctx with pragmatic, browser-like headers.
+func newRequest(ctx context.Context, link string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:142.0) Gecko/20100101 Firefox/142.0")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	req.Header.Set("Accept-Language", "de,en;q=0.8")
+	return req, nil
+}
+
+// setConditional turns req into a conditional GET for a copy with the given validators.
+// Empty validators are not sent.
+func setConditional(req *http.Request, etag, lastModified string) {
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+}
+
+// send executes req with client, retrying transient failures according to requestRetry.
+// Every attempt waits for its own requestLimiter slot. Transport errors already carry the URL.
+// The caller must close the response body.
+func send(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+	return requestRetry.Do(ctx, func(ctx context.Context) (*http.Response, error) {
+		// Be polite: wait for the host's next request slot.
+		if err := requestLimiter.Wait(ctx, req.URL.Host); err != nil {
+			return nil, err
+		}
+		return client.Do(req.Clone(ctx))
+	})
 }
 
 // RequestPage fetches a URL, parses the HTML, and returns:
 //   - doc: goquery document built from the response body
-//   - source: the raw HTML as a UTF-8 string
-//   - base: the base URL derived from the input link
+//   - source: the HTML decoded to a UTF-8 string
+//   - base: the base URL for resolving relative links
 //
-// On any error, it logs and exits.
+// The body is transcoded to UTF-8 (see decodeHTML), so labels with umlauts like
+// "Schätzwert" match on ISO-8859-1 pages too. base is the final URL after redirects,
+// overridden by a <base href> element if the page has one.
+//
+// Download errors are returned as-is, parse errors as *ParseError.
 // If the response is not HTML, parsing will fail.
-// Base URL is parsed from the provided link and does not reflect redirects.
-func RequestPage(link string) (doc *goquery.Document, source string, base *url.URL) {
+func RequestPage(ctx context.Context, link string) (doc *goquery.Document, source string, base *url.URL, err error) {
 
 	// download source code
-	body := Request(link)
+	resp, err := fetch(ctx, link)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	// Convert the page to UTF-8 before parsing; goquery expects UTF-8 input.
+	body, err := decodeHTML(resp.Body, resp.ContentType)
+	if err != nil {
+		return nil, "", nil, &ParseError{URL: link, Err: err}
+	}
 	source = string(body)
 
 	// Build a goquery document from the in-memory bytes.
-	var err error
 	doc, err = goquery.NewDocumentFromReader(bytes.NewReader(body))
 	if err != nil {
-		panic(err) // Abort if HTML cannot be parsed.
+		return nil, "", nil, &ParseError{URL: link, Err: err}
 	}
 
-	// Derive the base URL. Currently reads from an external variable.
-	// Consider using resp.Request.URL or the input link instead.
-	base, err = url.Parse(link)
+	// Derive the base URL from where the page actually came from, not from the requested link.
+	base, err = url.Parse(resp.URL)
 	if err != nil {
-		panic(err)
+		return nil, "", nil, &ParseError{URL: link, Err: err}
+	}
+
+	// A <base href> element takes precedence; it may itself be relative to the document URL.
+	if href, ok := doc.Find("base[href]").First().Attr("href"); ok {
+		if ref, err := url.Parse(strings.TrimSpace(href)); err == nil {
+			base = base.ResolveReference(ref)
+		}
 	}
 
 	// Return the parsed document and the base URL.
-	return doc, source, base
+	return doc, source, base, nil
+}
+
+// decodeHTML converts an HTML body to UTF-8.
+// The encoding is taken from a byte order mark, the Content-Type charset or a
+// <meta charset> tag. Undeclared or only weakly declared (meta tag) pages that are
+// valid UTF-8 are kept as-is, since Lotus Notes sometimes mislabels UTF-8 pages.
+func decodeHTML(body []byte, contentType string) ([]byte, error) {
+	enc, name, certain := charset.DetermineEncoding(body, contentType)
+	if name == "utf-8" || (!certain && utf8.Valid(body)) {
+		return body, nil
+	}
+	return enc.NewDecoder().Bytes(body)
 }
@@ -0,0 +1,140 @@
+// Package retry repeats HTTP requests that failed for transient reasons,
+// using exponential backoff with jitter and honouring Retry-After.
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Error classes that a Policy can treat as retryable.
+const (
+	ErrorTimeout    = "timeout"    // network or server timeout
+	ErrorConnection = "connection" // connection refused or reset, temporary DNS failure
+	ErrorEOF        = "eof"        // connection closed before a complete response
+)
+
+// Policy decides whether and when a failed request is repeated.
+type Policy struct {
+	MaxAttempts   int           // total number of attempts including the first; values < 1 mean 1
+	BaseDelay     time.Duration // delay before the first retry; doubles with every further retry
+	MaxDelay      time.Duration // upper bound for a single delay, also for Retry-After
+	RetryStatuses []int         // HTTP status codes that are retried, e.g. 503
+	RetryErrors   []string      // error classes that are retried, see ErrorTimeout etc.
+}
+
+// Default retries typical transient failures of public web services.
+var Default = Policy{
+	MaxAttempts:   4,
+	BaseDelay:     time.Second,
+	MaxDelay:      30 * time.Second,
+	RetryStatuses: []int{http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout},
+	RetryErrors:   []string{ErrorTimeout, ErrorConnection, ErrorEOF},
+}
+
+// Do calls attempt until it succeeds, fails permanently or MaxAttempts is reached.
+//
+// A response is retried if its status is in RetryStatuses; its body is closed before the next attempt.
+// An error is retried if its class is in RetryErrors. The delay before retry n (starting at 0) is
+// BaseDelay*2^n, capped at MaxDelay, with the upper half randomized. A Retry-After header
+// replaces the computed delay; if it asks for more than MaxDelay, Do gives up instead of waiting.
+//
+// Do returns the last response or error as-is, so callers handle a final 503 like any other status.
+// Cancelling ctx stops waiting and returns ctx.Err().
+func (p Policy) Do(ctx context.Context, attempt func(ctx context.Context) (*http.Response, error)) (*http.Response, error) {
+	for n := 0; ; n++ {
+		resp, err := attempt(ctx)
+
+		// Decide whether this outcome is worth another attempt.
+		last := n+1 >= p.MaxAttempts || ctx.Err() != nil
+		if last || !p.retryable(resp, err) {
+			return resp, err
+		}
+
+		delay := p.backoff(n)
+		if resp != nil {
+			if after, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				if after > p.MaxDelay {
+					return resp, err // the server wants us to come back much later
+				}
+				delay = after
+			}
+			// Drain a little so the connection can be reused, then discard the response.
+			_, _ = io.CopyN(io.Discard, resp.Body, 4<<10)
+			_ = resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable reports whether the outcome of an attempt should be retried.
+func (p Policy) retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		class := Classify(err)
+		return class != "" && slices.Contains(p.RetryErrors, class)
+	}
+	return resp != nil && slices.Contains(p.RetryStatuses, resp.StatusCode)
+}
+
+// backoff returns the delay before retry n: BaseDelay*2^n capped at MaxDelay, upper half jittered.
+func (p Policy) backoff(n int) time.Duration {
+	d := p.BaseDelay << min(n, 30)
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + rand.N(half+1)
+}
+
+// Classify returns the error class of a transport error, or "" if it is not transient.
+// Context cancellation of the caller is never transient.
+func Classify(err error) string {
+	if errors.Is(err, context.Canceled) {
+		return ""
+	}
+
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ErrorTimeout
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET),
+		errors.As(err, &dnsErr) && dnsErr.IsTemporary:
+		return ErrorConnection
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrorEOF
+	}
+	return ""
+}
+
+// retryAfter parses a Retry-After header, given either as seconds or as an HTTP date.
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
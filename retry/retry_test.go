@@ -0,0 +1,217 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	p := Policy{BaseDelay: time.Second, MaxDelay: 10 * time.Second}
+	tests := []struct {
+		n    int
+		want time.Duration // delay before jitter
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{4, 10 * time.Second}, // capped
+		{40, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		// The upper half is random: every delay lies in [want/2, want].
+		for range 100 {
+			if got := p.backoff(tt.n); got < tt.want/2 || got > tt.want {
+				t.Fatalf("backoff(%d) = %v, want within [%v, %v]", tt.n, got, tt.want/2, tt.want)
+			}
+		}
+	}
+
+	if got := (Policy{}).backoff(3); got != 0 {
+		t.Errorf("backoff without delays = %v, want 0", got)
+	}
+	if got := (Policy{BaseDelay: time.Second}).backoff(62); got < 0 {
+		t.Errorf("backoff without cap overflowed to %v", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 5, 1, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"5", 5 * time.Second, true},
+		{"0", 0, true},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{now.Add(-time.Hour).Format(http.TimeFormat), 0, true}, // in the past: retry now
+		{"", 0, false},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := retryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// timeoutError is a net.Error that timed out.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassify(t *testing.T) {
+	dial := func(errno syscall.Errno) error {
+		return &url.Error{Op: "Get", URL: "https://example.com", Err: &net.OpError{Op: "dial", Net: "tcp",
+			Err: os.NewSyscallError("connect", errno)}}
+	}
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{context.DeadlineExceeded, ErrorTimeout},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: timeoutError{}}, ErrorTimeout},
+		{dial(syscall.ECONNREFUSED), ErrorConnection},
+		{dial(syscall.ECONNRESET), ErrorConnection},
+		{&net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}, ErrorConnection},
+		{&net.DNSError{Err: "no such host", Name: "example.com", IsNotFound: true}, ""},
+		{fmt.Errorf("read body: %w", io.ErrUnexpectedEOF), ErrorEOF},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: io.EOF}, ErrorEOF},
+		{context.Canceled, ""},
+		{fmt.Errorf("request: %w", context.Canceled), ""},
+		{errors.New("x509: certificate signed by unknown authority"), ""},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("Classify(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+// outcome is the result of one attempt in TestDo: a status code or an error.
+type outcome struct {
+	status     int
+	retryAfter string
+	err        error
+}
+
+// trackedBody records whether it was closed.
+type trackedBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackedBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestDo(t *testing.T) {
+	p := Policy{
+		MaxAttempts:   3,
+		BaseDelay:     time.Millisecond,
+		MaxDelay:      10 * time.Millisecond,
+		RetryStatuses: []int{http.StatusServiceUnavailable},
+		RetryErrors:   []string{ErrorConnection},
+	}
+	reset := os.NewSyscallError("read", syscall.ECONNRESET)
+	tests := []struct {
+		name       string
+		outcomes   []outcome
+		wantCalls  int
+		wantStatus int // 0 if an error is expected
+	}{
+		{"success", []outcome{{status: 200}}, 1, 200},
+		{"retried status", []outcome{{status: 503}, {status: 503}, {status: 200}}, 3, 200},
+		{"permanent status", []outcome{{status: 404}, {status: 200}}, 1, 404},
+		{"attempts exhausted", []outcome{{status: 503}, {status: 503}, {status: 503}, {status: 200}}, 3, 503},
+		{"retried error", []outcome{{err: reset}, {status: 200}}, 2, 200},
+		{"error class not configured", []outcome{{err: context.DeadlineExceeded}, {status: 200}}, 1, 0},
+		{"short Retry-After", []outcome{{status: 503, retryAfter: "0"}, {status: 200}}, 2, 200},
+		{"long Retry-After", []outcome{{status: 503, retryAfter: "3600"}, {status: 200}}, 1, 503},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bodies []*trackedBody
+			calls := 0
+			resp, err := p.Do(context.Background(), func(context.Context) (*http.Response, error) {
+				o := tt.outcomes[calls]
+				calls++
+				if o.err != nil {
+					return nil, o.err
+				}
+				body := &trackedBody{Reader: strings.NewReader("body")}
+				bodies = append(bodies, body)
+				resp := &http.Response{StatusCode: o.status, Header: http.Header{}, Body: body}
+				if o.retryAfter != "" {
+					resp.Header.Set("Retry-After", o.retryAfter)
+				}
+				return resp, nil
+			})
+			if calls != tt.wantCalls {
+				t.Errorf("attempts = %d, want %d", calls, tt.wantCalls)
+			}
+			switch {
+			case tt.wantStatus == 0 && err == nil:
+				t.Errorf("Do = %d, want an error", resp.StatusCode)
+			case tt.wantStatus != 0 && (err != nil || resp.StatusCode != tt.wantStatus):
+				t.Errorf("Do = %v, %v; want status %d", resp, err, tt.wantStatus)
+			}
+
+			// Discarded responses are closed, the returned one is left to the caller.
+			for i, b := range bodies {
+				if last := i == len(bodies)-1 && err == nil; b.closed == last {
+					t.Errorf("body %d closed = %v", i, b.closed)
+				}
+			}
+		})
+	}
+}
+
+func TestDoCancel(t *testing.T) {
+	p := Policy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour, RetryStatuses: []int{http.StatusServiceUnavailable}}
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	resp, err := p.Do(ctx, func(context.Context) (*http.Response, error) {
+		calls++
+		return &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(""))}, nil
+	})
+	if !errors.Is(err, context.Canceled) || resp != nil {
+		t.Errorf("Do = %v, %v; want context.Canceled", resp, err)
+	}
+	if calls != 1 {
+		t.Errorf("attempts = %d, want 1", calls)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Do returned after %v, want it to stop waiting on cancellation", d)
+	}
+
+	// A cancelled context is not retried, even if the error class would be.
+	p.RetryErrors = []string{ErrorTimeout}
+	calls = 0
+	_, err = p.Do(ctx, func(ctx context.Context) (*http.Response, error) {
+		calls++
+		return nil, ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) || calls != 1 {
+		t.Errorf("Do with cancelled context = %v after %d attempts, want context.Canceled after 1", err, calls)
+	}
+}
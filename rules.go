@@ -0,0 +1,105 @@
+package main
+
+import (
+	"ediktscraper/expr"
+	"fmt"
+	"time"
+)
+
+// ruleFields declares the fields a profile rule may use, see Profile.Rules and package expr.
+// Amounts are in EUR, sizes in m², dates are texts in the form "2025-11-03".
+var ruleFields = expr.Fields{
+	"schaetzwert":      expr.Number, // appraised value
+	"geringstes_gebot": expr.Number, // lowest admissible bid
+	"vadium":           expr.Number, // security deposit
+	"objektgroesse":    expr.Number, // object size
+	"grundgroesse":     expr.Number, // lot size
+	"groesse":          expr.Number, // lot size, or object size without a lot (like min_size/max_size)
+	"langgutachten":    expr.Number, // number of long appraisal files
+	"entfernung_km":    expr.Number, // distance from the profile's home; known after geocoding
+	"zubehoerwert":     expr.Number, // value of the accessories; known after the Kurzgutachten fetch
+	"kategorie":        expr.String, // category code, e.g. "UL"
+	"dienststelle":     expr.String, // court, e.g. "BG Linz"
+	"aktenzeichen":     expr.String, // case number
+	"plz_ort":          expr.String, // postal code and town, e.g. "4020 Linz"
+	"adresse":          expr.String, // street address
+	"status":           expr.String, // "aktiv", "verschoben", "abberaumt" or "zuschlag"
+	"termin":           expr.String, // auction date, empty if unknown
+	"stichtag":         expr.String, // valuation date; known after the Kurzgutachten fetch
+}
+
+// ruleValues returns the values of ruleFields for rec.
+// Fields that are not known yet are left out: the distance if km is nil, and the fields of
+// the Kurzgutachten before it was fetched.
+func ruleValues(rec *EdiktRecord, km *int) map[string]any {
+	v := map[string]any{
+		"schaetzwert":      rec.Schaetzwert,
+		"geringstes_gebot": rec.GeringstesGebot,
+		"vadium":           rec.Vadium,
+		"objektgroesse":    rec.Objektgroesse,
+		"grundgroesse":     rec.Grundstuecksgroesse,
+		"groesse":          Profile{}.size(rec),
+		"langgutachten":    len(rec.LanggutachtenLinks),
+		"kategorie":        string(findCategory(rec.Kategorie)),
+		"dienststelle":     rec.Dienststelle,
+		"aktenzeichen":     rec.Aktenzeichen,
+		"plz_ort":          rec.PlzOrt,
+		"adresse":          rec.Liegenschaftsadresse,
+		"status":           string(rec.Status),
+		"termin":           ruleDate(rec.Versteigerungstermin),
+	}
+	if km != nil {
+		v["entfernung_km"] = *km
+	}
+	if rec.Kurzgutachten != nil {
+		v["zubehoerwert"] = rec.Zubehoerwert
+		v["stichtag"] = ruleDate(rec.Stichtag)
+	}
+	return v
+}
+
+// ruleDate formats t for rules, so dates compare as texts: termin >= "2025-11-01".
+func ruleDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.DateOnly)
+}
+
+// compileRules compiles the rules of p against ruleFields.
+func compileRules(p Profile) ([]*expr.Program, error) {
+	progs := make([]*expr.Program, 0, len(p.Rules))
+	for i, src := range p.Rules {
+		prog, err := expr.Compile(src, ruleFields)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		progs = append(progs, prog)
+	}
+	return progs, nil
+}
+
+// CheckRules evaluates the profile's rules with values, see ruleValues.
+// It returns a reason like "Rule 2" and false for the first rule that rejects.
+// If partial is true, rules that use a field without a value pass and are decided later;
+// otherwise a missing value, like any evaluation error, rejects with the error in the reason.
+func (p Profile) CheckRules(values map[string]any, partial bool) (reason string, ok bool) {
+rules:
+	for i, prog := range p.rules {
+		if partial {
+			for _, name := range prog.Fields() {
+				if _, ok := values[name]; !ok {
+					continue rules
+				}
+			}
+		}
+		match, err := prog.Eval(values)
+		if err != nil {
+			return fmt.Sprintf("Rule %d: %v", i+1, err), false
+		}
+		if !match {
+			return fmt.Sprintf("Rule %d", i+1), false
+		}
+	}
+	return "", true
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchBaseURL is the Lotus Notes search view of the edikte portal for auctions ("eex").
+const searchBaseURL = "https://edikte.justiz.gv.at/edikte/ex/exedi3.nsf/suchedi"
+
+// searchMax is the default maximum number of results the portal returns per query.
+const searchMax = 4999
+
+// Category is a real-estate category ("VKat") of the edikte portal.
+type Category string
+
+const (
+	CategoryEigentumswohnung     Category = "EW" // Eigentumswohnung
+	CategoryEinfamilienhaus      Category = "EH" // Einfamilienhaus
+	CategoryZweifamilienhaus     Category = "ZH" // Zweifamilienhaus
+	CategoryMehrfamilienhaus     Category = "MH" // Mehrfamilienhaus
+	CategoryGewerblich           Category = "GL" // gewerbliche Liegenschaft
+	CategoryUnbebaut             Category = "UL" // unbebaute Liegenschaft (Baugrund)
+	CategoryLandForst            Category = "LF" // land- und forstwirtschaftlich genutzte Liegenschaft
+	CategoryBaurecht             Category = "BR" // Baurecht
+	CategorySuperaedifikat       Category = "SE" // Superädifikat
+	CategoryWohnungseigentumsobj Category = "WE" // sonstiges Wohnungseigentumsobjekt (Garage, Abstellplatz, ...)
+	CategorySonstiges            Category = "SO" // sonstige Liegenschaft
+)
+
+// categoryNames maps each known Category to the label shown by the portal.
+var categoryNames = map[Category]string{
+	CategoryEigentumswohnung:     "Eigentumswohnung",
+	CategoryEinfamilienhaus:      "Einfamilienhaus",
+	CategoryZweifamilienhaus:     "Zweifamilienhaus",
+	CategoryMehrfamilienhaus:     "Mehrfamilienhaus",
+	CategoryGewerblich:           "Gewerbliche Liegenschaft",
+	CategoryUnbebaut:             "Unbebaute Liegenschaft",
+	CategoryLandForst:            "Land- und forstwirtschaftlich genutzte Liegenschaft",
+	CategoryBaurecht:             "Baurecht",
+	CategorySuperaedifikat:       "Superädifikat",
+	CategoryWohnungseigentumsobj: "Wohnungseigentumsobjekt",
+	CategorySonstiges:            "Sonstige Liegenschaft",
+}
+
+// String returns the portal label of the category, or the raw code if it is unknown.
+func (c Category) String() string {
+	if name, ok := categoryNames[c]; ok {
+		return name
+	}
+	return string(c)
+}
+
+// Valid reports whether c is a known category code.
+func (c Category) Valid() bool {
+	_, ok := categoryNames[c]
+	return ok
+}
+
+// Bundesland is an Austrian federal state, identified by its official code (1-9).
+type Bundesland int
+
+const (
+	Burgenland Bundesland = iota + 1
+	Kaernten
+	Niederoesterreich
+	Oberoesterreich
+	Salzburg
+	Steiermark
+	Tirol
+	Vorarlberg
+	Wien
+)
+
+// bundeslandNames holds the names of all states, indexed by code-1.
+var bundeslandNames = []string{
+	"Burgenland", "Kärnten", "Niederösterreich", "Oberösterreich", "Salzburg",
+	"Steiermark", "Tirol", "Vorarlberg", "Wien",
+}
+
+// String returns the name of the state.
+func (b Bundesland) String() string {
+	if b < Burgenland || b > Wien {
+		return strconv.Itoa(int(b))
+	}
+	return bundeslandNames[b-1]
+}
+
+// MarshalText encodes the state by name, so config files stay readable.
+func (b Bundesland) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText accepts the name (case-insensitive) or the numeric code of a state.
+func (b *Bundesland) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	for i, name := range bundeslandNames {
+		if strings.EqualFold(s, name) || s == strconv.Itoa(i+1) {
+			*b = Bundesland(i + 1)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown Bundesland %q", s)
+}
+
+// ------------------------------------------------------------------------------------------------------------------ //
+
+// SearchQuery describes one search on the edikte portal.
+// Empty fields do not restrict the search. Multiple categories or states are combined with OR.
+type SearchQuery struct {
+	Categories    []Category   // "VKat" real-estate categories
+	Bundeslaender []Bundesland // federal states
+	Dienststelle  string       // court, e.g. "BG Linz"
+	TerminVon     time.Time    // earliest auction date (inclusive)
+	TerminBis     time.Time    // latest auction date (inclusive)
+	FullText      string       // free-text search ("ftquery")
+	Max           int          // maximum number of results; 0 uses searchMax
+}
+
+// Lotus Notes field names used in the query string.
+const (
+	fieldKategorie    = "VKat"
+	fieldBundesland   = "BL"
+	fieldDienststelle = "Dst"
+	fieldTermin       = "VDat"
+)
+
+// URL returns the "suchedi?SearchView" URL for the query.
+// The layout mirrors the portal's own search form, e.g. for a single category:
+//
+//	suchedi?SearchView&subf=eex&SearchOrder=4&SearchMax=4999&retfields=~VKat=UL&ftquery=&query=%28%5BVKat%5D%3D%28UL%29%29
+func (q SearchQuery) URL() string {
+
+	// "retfields" pre-fills the search form; "query" is the actual full-text query.
+	var retfields strings.Builder
+	var clauses []string
+
+	// Categories: ([VKat]=(UL) OR [VKat]=(LF))
+	if len(q.Categories) > 0 {
+		alts := make([]string, 0, len(q.Categories))
+		for _, c := range q.Categories {
+			fmt.Fprintf(&retfields, "~%s=%s", fieldKategorie, url.QueryEscape(string(c)))
+			alts = append(alts, fmt.Sprintf("[%s]=(%s)", fieldKategorie, string(c)))
+		}
+		clauses = append(clauses, strings.Join(alts, " OR "))
+	}
+
+	// States: ([BL]=(4) OR [BL]=(6))
+	if len(q.Bundeslaender) > 0 {
+		alts := make([]string, 0, len(q.Bundeslaender))
+		for _, b := range q.Bundeslaender {
+			fmt.Fprintf(&retfields, "~%s=%d", fieldBundesland, int(b))
+			alts = append(alts, fmt.Sprintf("[%s]=(%d)", fieldBundesland, int(b)))
+		}
+		clauses = append(clauses, strings.Join(alts, " OR "))
+	}
+
+	// Court: ([Dst]=(BG Linz))
+	if q.Dienststelle != "" {
+		fmt.Fprintf(&retfields, "~%s=%s", fieldDienststelle, url.QueryEscape(q.Dienststelle))
+		clauses = append(clauses, fmt.Sprintf("[%s]=(%s)", fieldDienststelle, q.Dienststelle))
+	}
+
+	// Auction date range: ([VDat]>=01.11.2025) AND ([VDat]<=30.11.2025)
+	if !q.TerminVon.IsZero() {
+		clauses = append(clauses, fmt.Sprintf("[%s]>=%s", fieldTermin, q.TerminVon.Format("02.01.2006")))
+	}
+	if !q.TerminBis.IsZero() {
+		clauses = append(clauses, fmt.Sprintf("[%s]<=%s", fieldTermin, q.TerminBis.Format("02.01.2006")))
+	}
+
+	// Wrap each clause in parentheses and combine with AND.
+	for i, c := range clauses {
+		clauses[i] = "(" + c + ")"
+	}
+	query := strings.Join(clauses, " AND ")
+
+	// "SearchView" is a bare Notes command without a value, so the URL is assembled by hand.
+	return searchBaseURL + "?SearchView&subf=eex&SearchOrder=4" +
+		"&SearchMax=" + strconv.Itoa(q.limit()) +
+		"&retfields=" + retfields.String() +
+		"&ftquery=" + url.QueryEscape(q.FullText) +
+		"&query=" + url.QueryEscape(query)
+}
+
+// limit returns the maximum number of results the portal returns for q.
+func (q SearchQuery) limit() int {
+	if q.Max <= 0 {
+		return searchMax
+	}
+	return q.Max
+}
+
+// split divides q into sub-queries that together cover the same results.
+// It first splits by Bundesland, then halves the auction date range; open range ends
+// are closed around today first. Returns nil if q cannot be split any further.
+func (q SearchQuery) split(today time.Time) []SearchQuery {
+	// One query per state.
+	if len(q.Bundeslaender) != 1 {
+		states := q.Bundeslaender
+		if len(states) == 0 {
+			for b := Burgenland; b <= Wien; b++ {
+				states = append(states, b)
+			}
+		}
+		subs := make([]SearchQuery, 0, len(states))
+		for _, b := range states {
+			sub := q
+			sub.Bundeslaender = []Bundesland{b}
+			subs = append(subs, sub)
+		}
+		return subs
+	}
+
+	// Choose a split day inside the date range. The lower part ends at mid, the upper starts the day after.
+	day := 24 * time.Hour
+	var mid time.Time
+	switch {
+	case q.TerminVon.IsZero() && q.TerminBis.IsZero():
+		mid = today
+	case q.TerminVon.IsZero():
+		mid = q.TerminBis.AddDate(-1, 0, 0)
+	case q.TerminBis.IsZero():
+		mid = q.TerminVon.AddDate(0, 6, 0)
+	case q.TerminBis.Sub(q.TerminVon) < day:
+		return nil // a single day cannot be split
+	default:
+		// Whole days, so both parts start at midnight and no day falls between them.
+		days := int(q.TerminBis.Sub(q.TerminVon) / day)
+		mid = q.TerminVon.AddDate(0, 0, days/2)
+	}
+
+	lower, upper := q, q
+	lower.TerminBis = mid
+	upper.TerminVon = mid.Add(day)
+	return []SearchQuery{lower, upper}
+}
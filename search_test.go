@@ -0,0 +1,139 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSearchQueryURL(t *testing.T) {
+	// The example of the doc comment, as sent by the portal's own form.
+	got := SearchQuery{Categories: []Category{CategoryUnbebaut}}.URL()
+	want := searchBaseURL + "?SearchView&subf=eex&SearchOrder=4&SearchMax=4999&retfields=~VKat=UL&ftquery=&query=%28%5BVKat%5D%3D%28UL%29%29"
+	if got != want {
+		t.Errorf("URL =\n%s\nwant\n%s", got, want)
+	}
+
+	tests := []struct {
+		name      string
+		q         SearchQuery
+		retfields string
+		query     string
+		ftquery   string
+		max       string
+	}{
+		{"empty", SearchQuery{}, "", "", "", "4999"},
+		{"categories and states",
+			SearchQuery{Categories: []Category{CategoryUnbebaut, CategoryLandForst}, Bundeslaender: []Bundesland{Oberoesterreich, Steiermark}},
+			"~VKat=UL~VKat=LF~BL=4~BL=6", "([VKat]=(UL) OR [VKat]=(LF)) AND ([BL]=(4) OR [BL]=(6))", "", "4999"},
+		{"court with space and full text",
+			SearchQuery{Dienststelle: "BG Linz", FullText: "Grundstück & Wald", Max: 100},
+			"~Dst=BG+Linz", "([Dst]=(BG Linz))", "Grundstück & Wald", "100"},
+		{"date range",
+			SearchQuery{Categories: []Category{CategoryEigentumswohnung},
+				TerminVon: time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC), TerminBis: time.Date(2025, 11, 30, 0, 0, 0, 0, time.UTC)},
+			"~VKat=EW", "([VKat]=(EW)) AND ([VDat]>=01.11.2025) AND ([VDat]<=30.11.2025)", "", "4999"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.q.URL())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(u.RawQuery, "SearchView&subf=eex&SearchOrder=4&") {
+				t.Errorf("query string %q does not start with the SearchView command", u.RawQuery)
+			}
+
+			// Every special character of the values must be escaped, so they decode unchanged.
+			params, err := url.ParseQuery(u.RawQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range map[string]string{"SearchMax": tt.max, "query": tt.query, "ftquery": tt.ftquery} {
+				if got := params.Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+			if got := params.Get("retfields"); got != strings.ReplaceAll(tt.retfields, "+", " ") {
+				t.Errorf("retfields = %q, want %q", got, tt.retfields)
+			}
+			if !strings.Contains(u.RawQuery, "&retfields="+tt.retfields+"&") {
+				t.Errorf("raw retfields in %q, want %q", u.RawQuery, tt.retfields)
+			}
+		})
+	}
+}
+
+func TestSearchQuerySplit(t *testing.T) {
+	today := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	date := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	one := []Bundesland{Oberoesterreich}
+
+	tests := []struct {
+		name      string
+		q         SearchQuery
+		wantParts int
+		// For date splits: the end of the lower and the start of the upper part.
+		lowerBis, upperVon time.Time
+	}{
+		{"all states", SearchQuery{}, 9, time.Time{}, time.Time{}},
+		{"two states", SearchQuery{Bundeslaender: []Bundesland{Wien, Tirol}}, 2, time.Time{}, time.Time{}},
+		{"open range", SearchQuery{Bundeslaender: one}, 2, today, today.AddDate(0, 0, 1)},
+		{"open start", SearchQuery{Bundeslaender: one, TerminBis: date(2026, 6, 30)}, 2, date(2025, 6, 30), date(2025, 7, 1)},
+		{"open end", SearchQuery{Bundeslaender: one, TerminVon: date(2026, 5, 1)}, 2, date(2026, 11, 1), date(2026, 11, 2)},
+		{"closed range", SearchQuery{Bundeslaender: one, TerminVon: date(2026, 5, 1), TerminBis: date(2026, 5, 11)}, 2,
+			date(2026, 5, 6), date(2026, 5, 7)},
+		{"single day", SearchQuery{Bundeslaender: one, TerminVon: date(2026, 5, 1), TerminBis: date(2026, 5, 1)}, 0,
+			time.Time{}, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.q.Categories = []Category{CategoryUnbebaut}
+			tt.q.FullText = "Wald"
+			parts := tt.q.split(today)
+			if len(parts) != tt.wantParts {
+				t.Fatalf("split into %d parts, want %d", len(parts), tt.wantParts)
+			}
+
+			// Every part keeps the other criteria and is limited to one state.
+			for _, p := range parts {
+				if len(p.Bundeslaender) != 1 || len(p.Categories) != 1 || p.Categories[0] != CategoryUnbebaut || p.FullText != "Wald" {
+					t.Errorf("part %+v lost criteria of %+v", p, tt.q)
+				}
+			}
+			if tt.lowerBis.IsZero() {
+				return
+			}
+			lower, upper := parts[0], parts[1]
+			if !lower.TerminVon.Equal(tt.q.TerminVon) || !upper.TerminBis.Equal(tt.q.TerminBis) {
+				t.Errorf("parts %v–%v and %v–%v do not keep the range ends of %v–%v",
+					lower.TerminVon, lower.TerminBis, upper.TerminVon, upper.TerminBis, tt.q.TerminVon, tt.q.TerminBis)
+			}
+			if !lower.TerminBis.Equal(tt.lowerBis) || !upper.TerminVon.Equal(tt.upperVon) {
+				t.Errorf("split at %v / %v, want %v / %v", lower.TerminBis, upper.TerminVon, tt.lowerBis, tt.upperVon)
+			}
+		})
+	}
+}
+
+// TestSearchQuerySplitEnds checks that repeated splitting of an oversized query ends in single days.
+func TestSearchQuerySplitEnds(t *testing.T) {
+	today := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	queue := []SearchQuery{{Categories: []Category{CategoryUnbebaut}, Bundeslaender: []Bundesland{Wien},
+		TerminVon: today, TerminBis: today.AddDate(0, 0, 40)}}
+	days := 0
+	for len(queue) > 0 && days < 1000 {
+		q := queue[0]
+		queue = queue[1:]
+		parts := q.split(today)
+		if parts == nil {
+			days++
+			continue
+		}
+		queue = append(queue, parts...)
+	}
+	if days != 41 {
+		t.Errorf("splitting 41 days ended in %d single-day queries", days)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Status is the state of an auction as announced on its detail page.
+type Status string
+
+const (
+	StatusAktiv      Status = "aktiv"      // auction takes place as announced
+	StatusVerschoben Status = "verschoben" // auction was postponed to a new date
+	StatusAbberaumt  Status = "abberaumt"  // auction was cancelled ("abberaumt") or the proceedings stopped ("eingestellt")
+	StatusZuschlag   Status = "zuschlag"   // the property was sold ("Zuschlag erteilt")
+)
+
+// statusNames maps each known Status to its German label for reports.
+var statusNames = map[Status]string{
+	StatusAktiv:      "aktiv",
+	StatusVerschoben: "verschoben",
+	StatusAbberaumt:  "abberaumt/eingestellt",
+	StatusZuschlag:   "Zuschlag erteilt",
+}
+
+// String returns the German label, or the raw value for unknown statuses.
+func (s Status) String() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return string(s)
+}
+
+// Final reports whether the auction will not take place (anymore), so the edikt
+// can neither be bought nor change in a relevant way.
+func (s Status) Final() bool {
+	return s == StatusAbberaumt || s == StatusZuschlag
+}
+
+// Status patterns, strongest first: a sold property may also mention its postponed date.
+var (
+	reStatusZuschlag  = regexp.MustCompile(`(?i)zuschlag\s+(wurde\s+)?erteilt`)
+	reStatusAbberaumt = regexp.MustCompile(`(?i)\b(abberaumt|eingestellt|abgesagt|widerrufen)\b`)
+	reStatusVerlegt   = regexp.MustCompile(`(?i)\b(verschoben|verlegt|neuer\s+termin)\b`)
+
+	// reStatusAbberaumtBody is the cancellation phrase that also counts in the page body,
+	// e.g. "Versteigerungstermin wurde abberaumt". Without "wurde" it is too common in
+	// boilerplate like "Wird eine Versteigerung abberaumt, ...".
+	reStatusAbberaumtBody = regexp.MustCompile(`(?i)\b(Versteigerung|Termin)\w*\s+wurde\s+abberaumt`)
+)
+
+// maxStatusField is the length up to which a field value is searched for status words.
+const maxStatusField = 200
+
+// ParseStatus detects the auction status of a detail page.
+//
+// The portal announces status changes in headings and in the short fields at the top of the
+// page, e.g. "Versteigerung abberaumt" or "Termin verschoben auf ...". Only headings and
+// short field values are searched for the ambiguous words ("eingestellt", "verlegt", ...),
+// because the legal text in the page body uses them in general terms. Only the unambiguous
+// phrases "Zuschlag erteilt" and "Versteigerung/Termin wurde abberaumt" are also found
+// anywhere in the page text.
+// Pages without any marker are StatusAktiv.
+func ParseStatus(doc *goquery.Document, e Edikt) Status {
+	// Headings and the values of all labelled fields.
+	var parts []string
+	doc.Find("h1, h2, h3, h4, h5, h6, .alert, .hinweis, title").Each(func(_ int, s *goquery.Selection) {
+		parts = append(parts, s.Text())
+	})
+	for key := range e {
+		// Long values are descriptions, not status notes.
+		if value := e.GetTxt(key); len(value) <= maxStatusField {
+			parts = append(parts, key, value)
+		}
+	}
+	prominent := strings.Join(parts, "\n")
+	body := doc.Find("body").Text()
+
+	switch {
+	case reStatusZuschlag.MatchString(prominent) || reStatusZuschlag.MatchString(body):
+		return StatusZuschlag
+	case reStatusAbberaumt.MatchString(prominent) || reStatusAbberaumtBody.MatchString(body):
+		return StatusAbberaumt
+	case reStatusVerlegt.MatchString(prominent):
+		return StatusVerschoben
+	default:
+		return StatusAktiv
+	}
+}
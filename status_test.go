@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestParseStatus(t *testing.T) {
+	// Every fixture carries the same legal hint, which mentions "abberaumt",
+	// "eingestellt" and "verlegt" in general terms.
+	tests := []struct {
+		file string
+		want Status
+	}{
+		{"status_aktiv.html", StatusAktiv},
+		{"status_verschoben.html", StatusVerschoben},
+		{"status_abberaumt.html", StatusAbberaumt},
+		{"status_abberaumt_body.html", StatusAbberaumt},
+		{"status_zuschlag.html", StatusZuschlag},
+	}
+	base, _ := url.Parse("https://edikte.justiz.gv.at/edikte/ex/exedi3.nsf/alldoc/0123456789abcdef!OpenDocument")
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			f, err := os.Open("testdata/" + tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			doc, err := goquery.NewDocumentFromReader(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, rec := ParseEdikt(doc, base); rec.Status != tt.want {
+				t.Errorf("Status = %q, want %q", rec.Status, tt.want)
+			}
+		})
+	}
+}
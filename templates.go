@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// builtinTemplates are the default mail templates, see templates/*.tmpl.
+//
+//go:embed templates/*.tmpl
+var builtinTemplates embed.FS
+
+// Template files; each can be replaced by a file of the same name in TemplateConfig.Dir.
+const (
+	subjectTemplate = "subject.tmpl" // text/template, the subject line
+	textTemplate    = "text.tmpl"    // text/template, the plain text body; defines "card"
+	htmlTemplate    = "html.tmpl"    // html/template, the HTML body
+)
+
+// mailData is the data of the mail templates: the digest of one recipient and the run statistics.
+//
+//	.Recipient                   mail address
+//	.Cards                       new matches: .Profile, .URL, .Rec (EdiktRecord), .Km, .PricePerM2, .MapURL
+//	.Changes                     changed edikte: .URL, .Rec (nil if gone), .Changes (.Field, .Old, .New)
+//	.Failures                    failed items, one per URL: .URL, .Err
+//	.Stats                       runStats: .Started, .Profiles, .Listed, .Fetched, .Matches, .Changed, .Failed
+//
+// The templates may use the functions num (30.000), date (02.01.2006), orDash and file
+// (the file name of a document link), see digestFuncs.
+type mailData struct {
+	Recipient string
+	digest
+	Stats *runStats
+}
+
+// runStats summarizes a run for the mail templates.
+type runStats struct {
+	Started  time.Time
+	Profiles int // enabled profiles
+	Listed   int // edikte listed by the searches
+	Fetched  int // detail pages fetched: new, stale and tracked edikte
+	Matches  int // new matches, each edikt counted once
+	Changed  int // tracked edikte with changes
+	Failed   int // failed items, searches and home lookups
+}
+
+// mailTemplates are the parsed mail templates.
+type mailTemplates struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// TemplateConfig selects the mail templates.
+// Files in Dir named like the built-in templates replace them, see templates/*.tmpl;
+// an empty Dir uses the built-in templates only.
+type TemplateConfig struct {
+	Dir string `json:"dir"` // e.g. "templates"
+}
+
+// defaultTemplates are the built-in templates. Their "card" template renders the console preview.
+var defaultTemplates = func() *mailTemplates {
+	t, err := loadTemplates("")
+	if err != nil {
+		panic(err)
+	}
+	return t
+}()
+
+// loadTemplates parses the templates, taking each file from dir if it exists there.
+func loadTemplates(dir string) (*mailTemplates, error) {
+	read := func(name string) (string, []byte, error) {
+		if dir != "" {
+			path := filepath.Join(dir, name)
+			b, err := os.ReadFile(path)
+			if err == nil {
+				return path, b, nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return "", nil, err
+			}
+		}
+		b, err := builtinTemplates.ReadFile("templates/" + name)
+		return "built-in " + name, b, err
+	}
+
+	t := new(mailTemplates)
+	for _, name := range []string{subjectTemplate, textTemplate, htmlTemplate} {
+		path, src, err := read(name)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case subjectTemplate:
+			t.subject, err = texttemplate.New(path).Funcs(digestFuncs).Option("missingkey=error").Parse(string(src))
+		case textTemplate:
+			t.text, err = texttemplate.New(path).Funcs(digestFuncs).Option("missingkey=error").Parse(string(src))
+		case htmlTemplate:
+			t.html, err = htmltemplate.New(path).Funcs(digestFuncs).Option("missingkey=error").Parse(string(src))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// render renders the subject and both bodies for data. Line breaks in the subject are
+// replaced by spaces, since a header cannot contain them.
+func (t *mailTemplates) render(data *mailData) (subject, text, html string, err error) {
+	var b bytes.Buffer
+	if err := t.subject.Execute(&b, data); err != nil {
+		return "", "", "", err
+	}
+	subject = strings.Join(strings.Fields(b.String()), " ")
+
+	b.Reset()
+	if err := t.text.Execute(&b, data); err != nil {
+		return "", "", "", err
+	}
+	text = b.String()
+
+	b.Reset()
+	if err := t.html.Execute(&b, data); err != nil {
+		return "", "", "", err
+	}
+	return subject, text, b.String(), nil
+}
+
+// preview renders c for the console with the "card" template of the text body,
+// or with the built-in one if the text body does not define it.
+func (t *mailTemplates) preview(c card) string {
+	text := t.text
+	if text.Lookup("card") == nil {
+		text = defaultTemplates.text
+	}
+	var b strings.Builder
+	if err := text.ExecuteTemplate(&b, "card", c); err != nil {
+		return fmt.Sprint("Preview failed: ", err)
+	}
+	return b.String()
+}
+
+// sampleMailData returns made-up data that exercises every part of the templates,
+// for "template check".
+func sampleMailData() *mailData {
+	vienna := viennaLocation()
+	rec := &EdiktRecord{
+		URL:                  "https://edikte.justiz.gv.at/edikte/ex/exedi3.nsf/alldoc/0123456789abcdef!OpenDocument",
+		Dienststelle:         "BG Wels",
+		Aktenzeichen:         "12 E 34/25x",
+		Kategorie:            "Unbebaute Liegenschaft",
+		Status:               StatusVerschoben,
+		Versteigerungstermin: time.Date(2025, 11, 3, 9, 30, 0, 0, vienna),
+		Schaetzwert:          28500,
+		GeringstesGebot:      14250,
+		Vadium:               2850,
+		Grundstuecksgroesse:  812,
+		PlzOrt:               "4600 Wels",
+		Liegenschaftsadresse: "Beispielweg 1",
+		KurzgutachtenLink:    "https://edikte.justiz.gv.at/edikte/ex/exedi3.nsf/0/0123/$file/Kurzgutachten.pdf",
+		LanggutachtenLinks:   []string{"https://edikte.justiz.gv.at/edikte/ex/exedi3.nsf/0/0123/$file/Gutachten%201.pdf"},
+		Stichtag:             time.Date(2025, 6, 30, 0, 0, 0, 0, vienna),
+		Zubehoerwert:         1500,
+	}
+	return &mailData{
+		Recipient: "to@example.com",
+		digest: digest{
+			Cards: []card{{
+				Profile:    "default",
+				URL:        rec.URL,
+				Rec:        rec,
+				Km:         27,
+				PricePerM2: rec.Schaetzwert / rec.Grundstuecksgroesse,
+				MapURL:     "https://www.openstreetmap.org/?mlat=48.16000&mlon=14.03000#map=13/48.16000/14.03000",
+			}},
+			Changes: []ediktChanges{
+				{URL: rec.URL, Rec: rec, Changes: []FieldChange{{Field: "Versteigerungstermin", Old: "20.10.2025 09:30", New: "03.11.2025 09:30"}}},
+				{URL: "https://edikte.justiz.gv.at/edikte/ex/exedi3.nsf/alldoc/fedcba9876543210!OpenDocument",
+					Changes: []FieldChange{{Field: labelGone, Old: "veröffentlicht", New: "nicht mehr abrufbar"}}},
+			},
+			Failures: []failure{{URL: "https://edikte.justiz.gv.at/edikte/ex/exedi3.nsf/alldoc/1111!OpenDocument",
+				Err: errors.New("503 Service Unavailable")}},
+		},
+		Stats: &runStats{Started: time.Now(), Profiles: 1, Listed: 42, Fetched: 7, Matches: 1, Changed: 2, Failed: 1},
+	}
+}